@@ -8,10 +8,53 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// GenerateTerrakubeToken mimics the token generation from Terrakube Executor Java
-func GenerateTerrakubeToken(internalSecret string) (string, error) {
+// JobScope identifies the job a token is issued for
+type JobScope struct {
+	OrganizationId string
+	WorkspaceId    string
+	JobId          string
+}
+
+// GenerateJobToken mimics the token generation from Terrakube Executor Java,
+// with a lifetime of ttl and claims restricting the token to a single job.
+// It returns the signed token and its expiry.
+func GenerateJobToken(internalSecret string, scope JobScope, ttl time.Duration) (string, time.Time, error) {
+	decodedSecret, err := decodeSecret(internalSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiry := now.Add(ttl)
+	claims := jwt.MapClaims{
+		"iss":             "TerrakubeInternal",
+		"sub":             "TerrakubeInternal (TOKEN)",
+		"aud":             "TerrakubeInternal",
+		"email":           "no-reply@terrakube.io",
+		"email_verified":  true,
+		"name":            "TerrakubeInternal Client",
+		"organization_id": scope.OrganizationId,
+		"workspace_id":    scope.WorkspaceId,
+		"job_id":          scope.JobId,
+		"iat":             now.Unix(),
+		"exp":             expiry.Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// Typ header is automatically added as "JWT" by golang-jwt
+
+	signedToken, err := token.SignedString(decodedSecret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign Terrakube JWT: %w", err)
+	}
+
+	return signedToken, expiry, nil
+}
+
+// decodeSecret returns the signing key of the Terrakube internal secret
+func decodeSecret(internalSecret string) ([]byte, error) {
 	if internalSecret == "" {
-		return "", fmt.Errorf("InternalSecret is not configured, cannot generate Terrakube Token")
+		return nil, fmt.Errorf("InternalSecret is not configured, cannot generate Terrakube Token")
 	}
 
 	// The Java executor decodes the Base64URL string into raw bytes
@@ -20,28 +63,34 @@ func GenerateTerrakubeToken(internalSecret string) (string, error) {
 		// Fallback to standard base64 if URL encoding fails
 		decodedSecret, err = base64.StdEncoding.DecodeString(internalSecret)
 		if err != nil {
-			return "", fmt.Errorf("failed to decode InternalSecret: %w", err)
+			return nil, fmt.Errorf("failed to decode InternalSecret: %w", err)
 		}
 	}
+	return decodedSecret, nil
+}
 
-	claims := jwt.MapClaims{
-		"iss":            "TerrakubeInternal",
-		"sub":            "TerrakubeInternal (TOKEN)",
-		"aud":            "TerrakubeInternal",
-		"email":          "no-reply@terrakube.io",
-		"email_verified": true,
-		"name":           "TerrakubeInternal Client",
-		"iat":            time.Now().Unix(),
-		"exp":            time.Now().Add(30 * 24 * time.Hour).Unix(),
+// ValidateToken verifies that token is an unexpired Terrakube internal token
+// signed with the internal secret. Job tokens are rejected: they are handed to
+// the scripts of a job and must not grant access to other jobs.
+func ValidateToken(internalSecret string, token string) error {
+	decodedSecret, err := decodeSecret(internalSecret)
+	if err != nil {
+		return err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// Typ header is automatically added as "JWT" by golang-jwt
-
-	signedToken, err := token.SignedString(decodedSecret)
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return decodedSecret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer("TerrakubeInternal"),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign Terrakube JWT: %w", err)
+		return fmt.Errorf("invalid token: %w", err)
 	}
-
-	return signedToken, nil
+	if _, ok := claims["job_id"]; ok {
+		return fmt.Errorf("invalid token: job tokens are not accepted")
+	}
+	return nil
 }
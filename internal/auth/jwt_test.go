@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestValidateToken(t *testing.T) {
+	secret := base64.URLEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	otherSecret := base64.URLEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+	key, _ := decodeSecret(secret)
+	otherKey, _ := decodeSecret(otherSecret)
+
+	internalClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": "TerrakubeInternal",
+			"sub": "TerrakubeInternal (TOKEN)",
+			"aud": "TerrakubeInternal",
+			"iat": time.Now().Unix(),
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	jobToken, _, err := GenerateJobToken(secret, JobScope{OrganizationId: "org", WorkspaceId: "ws", JobId: "1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{
+			name:  "valid internal token",
+			token: sign(jwt.SigningMethodHS256, key, internalClaims()),
+		},
+		{
+			name: "expired",
+			token: sign(jwt.SigningMethodHS256, key, func() jwt.MapClaims {
+				c := internalClaims()
+				c["exp"] = time.Now().Add(-time.Minute).Unix()
+				return c
+			}()),
+			wantErr: "expired",
+		},
+		{
+			name: "missing exp",
+			token: sign(jwt.SigningMethodHS256, key, func() jwt.MapClaims {
+				c := internalClaims()
+				delete(c, "exp")
+				return c
+			}()),
+			wantErr: "exp",
+		},
+		{
+			name: "wrong issuer",
+			token: sign(jwt.SigningMethodHS256, key, func() jwt.MapClaims {
+				c := internalClaims()
+				c["iss"] = "someone-else"
+				return c
+			}()),
+			wantErr: "issuer",
+		},
+		{
+			name:    "alg none",
+			token:   sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, internalClaims()),
+			wantErr: "signing method",
+		},
+		{
+			name:    "other HMAC variant",
+			token:   sign(jwt.SigningMethodHS512, key, internalClaims()),
+			wantErr: "signing method",
+		},
+		{
+			name:    "wrong secret",
+			token:   sign(jwt.SigningMethodHS256, otherKey, internalClaims()),
+			wantErr: "signature",
+		},
+		{
+			name:    "job token",
+			token:   jobToken,
+			wantErr: "job tokens",
+		},
+		{
+			name:    "malformed",
+			token:   "not.a.token",
+			wantErr: "malformed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateToken(secret, tt.token)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateToken() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateToken() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
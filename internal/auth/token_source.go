@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenSource hands out the tokens of a job. Token returns a token renewed
+// once it has less than a quarter of its lifetime left, for requests made by
+// the executor. TokenValidFor returns a token that stays valid for a given
+// duration, for processes such as terraform that cannot pick up a new token
+// while they run.
+type TokenSource struct {
+	mu        sync.Mutex
+	secret    string
+	scope     JobScope
+	ttl       time.Duration
+	token     string
+	expiry    time.Time
+	onRefresh []func(token string)
+}
+
+func NewTokenSource(internalSecret string, scope JobScope, ttl time.Duration) *TokenSource {
+	return &TokenSource{
+		secret: internalSecret,
+		scope:  scope,
+		ttl:    ttl,
+	}
+}
+
+// Token returns a valid token for the job
+func (s *TokenSource) Token() (string, error) {
+	return s.TokenValidFor(s.ttl / 4)
+}
+
+// TokenValidFor returns a token for the job that does not expire within d,
+// generating a new one if the current token would
+func (s *TokenSource) TokenValidFor(d time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Until(s.expiry) > d {
+		return s.token, nil
+	}
+
+	ttl := s.ttl
+	if d >= ttl {
+		ttl = d + s.ttl/4
+	}
+	token, expiry, err := GenerateJobToken(s.secret, s.scope, ttl)
+	if err != nil {
+		return "", err
+	}
+	refreshed := s.token != ""
+	s.token, s.expiry = token, expiry
+
+	if refreshed {
+		for _, fn := range s.onRefresh {
+			fn(token)
+		}
+	}
+	return token, nil
+}
+
+// OnRefresh registers fn to be called with every token replacing a previous one
+func (s *TokenSource) OnRefresh(fn func(token string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onRefresh = append(s.onRefresh, fn)
+}
@@ -2,12 +2,15 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 )
 
+// TerrakubeClient calls the Terrakube API with the token passed to each call,
+// falling back to Token
 type TerrakubeClient struct {
 	ApiUrl     string
 	Token      string
@@ -25,49 +28,62 @@ func NewTerrakubeClient(apiUrl string, token string) *TerrakubeClient {
 }
 
 // UpdateJobStatus updates the job status in Terrakube API
-func (c *TerrakubeClient) UpdateJobStatus(orgId, jobId string, status string, output string) error {
-	// Simplified payload for now
+func (c *TerrakubeClient) UpdateJobStatus(ctx context.Context, token, orgId, jobId string, status string, output string) error {
+	return c.UpdateJob(ctx, token, orgId, jobId, map[string]interface{}{
+		"status": status,
+		"output": output,
+	})
+}
+
+// UpdateJob updates arbitrary job attributes
+func (c *TerrakubeClient) UpdateJob(ctx context.Context, token, orgId, jobId string, attributes map[string]interface{}) error {
 	payload := map[string]interface{}{
 		"data": map[string]interface{}{
-			"type": "job",
-			"id":   jobId,
-			"attributes": map[string]interface{}{
-				"status": status,
-				"output": output,
-			},
+			"type":       "job",
+			"id":         jobId,
+			"attributes": attributes,
 		},
 	}
-	return c.patch(fmt.Sprintf("/api/v1/organization/%s/job/%s", orgId, jobId), payload)
+	return c.patch(ctx, token, fmt.Sprintf("/api/v1/organization/%s/job/%s", orgId, jobId), payload)
 }
 
 // UpdateStepStatus updates the step status
-func (c *TerrakubeClient) UpdateStepStatus(orgId, jobId, stepId string, status string, output string) error {
+func (c *TerrakubeClient) UpdateStepStatus(ctx context.Context, token, orgId, jobId, stepId string, status string, output string) error {
+	return c.UpdateStep(ctx, token, orgId, jobId, stepId, map[string]interface{}{
+		"status": status,
+		"output": output,
+	})
+}
+
+// UpdateStep updates arbitrary step attributes
+func (c *TerrakubeClient) UpdateStep(ctx context.Context, token, orgId, jobId, stepId string, attributes map[string]interface{}) error {
 	payload := map[string]interface{}{
 		"data": map[string]interface{}{
-			"type": "step",
-			"id":   stepId,
-			"attributes": map[string]interface{}{
-				"status": status,
-				"output": output,
-			},
+			"type":       "step",
+			"id":         stepId,
+			"attributes": attributes,
 		},
 	}
-	return c.patch(fmt.Sprintf("/api/v1/organization/%s/job/%s/step/%s", orgId, jobId, stepId), payload)
+	return c.patch(ctx, token, fmt.Sprintf("/api/v1/organization/%s/job/%s/step/%s", orgId, jobId, stepId), payload)
 }
 
-func (c *TerrakubeClient) patch(path string, payload interface{}) error {
+func (c *TerrakubeClient) patch(ctx context.Context, token, path string, payload interface{}) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("PATCH", fmt.Sprintf("%s%s", c.ApiUrl, path), bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "PATCH", fmt.Sprintf("%s%s", c.ApiUrl, path), bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/vnd.api+json")
-	if c.Token != "" {
-		req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	if token == "" {
+		token = c.Token
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
 	}
 
 	resp, err := c.HttpClient.Do(req)
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type request struct {
+	method, path, contentType, auth string
+	body                            map[string]interface{}
+}
+
+func recordServer(t *testing.T, status int) (*httptest.Server, *[]request) {
+	t.Helper()
+	var requests []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read body: %v", err)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Errorf("body %q is not JSON: %v", raw, err)
+		}
+		requests = append(requests, request{r.Method, r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Authorization"), body})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestPatchBodies(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(c *TerrakubeClient) error
+		path string
+		body string
+	}{
+		{
+			name: "job status",
+			call: func(c *TerrakubeClient) error {
+				return c.UpdateJobStatus(context.Background(), "tok", "org", "job", "running", "")
+			},
+			path: "/api/v1/organization/org/job/job",
+			body: `{"data":{"type":"job","id":"job","attributes":{"status":"running","output":""}}}`,
+		},
+		{
+			name: "job plan changes",
+			call: func(c *TerrakubeClient) error {
+				return c.UpdateJob(context.Background(), "tok", "org", "job", map[string]interface{}{"planChanges": false})
+			},
+			path: "/api/v1/organization/org/job/job",
+			body: `{"data":{"type":"job","id":"job","attributes":{"planChanges":false}}}`,
+		},
+		{
+			name: "step status",
+			call: func(c *TerrakubeClient) error {
+				return c.UpdateStepStatus(context.Background(), "tok", "org", "job", "step", "failed", "boom")
+			},
+			path: "/api/v1/organization/org/job/job/step/step",
+			body: `{"data":{"type":"step","id":"step","attributes":{"status":"failed","output":"boom"}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := recordServer(t, http.StatusOK)
+			if err := tt.call(NewTerrakubeClient(srv.URL, "")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(*requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(*requests))
+			}
+			got := (*requests)[0]
+			if got.method != http.MethodPatch || got.path != tt.path {
+				t.Errorf("got %s %s, want PATCH %s", got.method, got.path, tt.path)
+			}
+			if got.contentType != "application/vnd.api+json" {
+				t.Errorf("got content type %q", got.contentType)
+			}
+			if got.auth != "Bearer tok" {
+				t.Errorf("got authorization %q", got.auth)
+			}
+			var want map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.body), &want); err != nil {
+				t.Fatal(err)
+			}
+			gotBody, _ := json.Marshal(got.body)
+			wantBody, _ := json.Marshal(want)
+			if string(gotBody) != string(wantBody) {
+				t.Errorf("got body %s, want %s", gotBody, wantBody)
+			}
+		})
+	}
+}
+
+func TestPatchDefaultToken(t *testing.T) {
+	srv, requests := recordServer(t, http.StatusNoContent)
+	if err := NewTerrakubeClient(srv.URL, "default").UpdateJobStatus(context.Background(), "", "org", "job", "running", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := (*requests)[0].auth; got != "Bearer default" {
+		t.Errorf("got authorization %q, want the default token", got)
+	}
+}
+
+func TestPatchRejected(t *testing.T) {
+	srv, _ := recordServer(t, http.StatusBadRequest)
+	if err := NewTerrakubeClient(srv.URL, "").UpdateJob(context.Background(), "tok", "org", "job", map[string]interface{}{"planChanges": true}); err == nil {
+		t.Fatal("expected an error for a 400 response")
+	}
+}
@@ -3,8 +3,12 @@ package config
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ilkerispir/terrakube-executor/internal/model"
 )
@@ -18,6 +22,52 @@ type Config struct {
 	StorageType             string
 	StorageAccountName      string
 	StorageAccountKey       string
+	WorkerCount             int
+	QueueSize               int
+	CancelGracePeriod       time.Duration
+	JobTimeout              time.Duration
+	CloneTimeout            time.Duration
+	InstallTimeout          time.Duration
+	InitTimeout             time.Duration
+	ExecutionTimeout        time.Duration
+	ScriptTimeout           time.Duration
+	DrainTimeout            time.Duration
+	JobHistorySize          int
+	LogBufferKB             int
+	LogHistoryKB            int
+	TokenTTL                time.Duration
+	AuthEnabled             bool
+	TLSCertFile             string
+	TLSKeyFile              string
+	TLSClientCAFile         string
+	SSHKnownHostsFile       string
+	SSHStrictHostKeyCheck   string
+	TofuGPGKeyFile          string
+	TofuGPGKeyURL           string
+	TofuGPGKeyFingerprint   string
+	VersionIndexOffline     bool
+	VersionIndexTTL         time.Duration
+	BinaryLocalDir          string
+	BinaryMirrorURL         string
+	BinaryStoragePrefix     string
+	BinarySources           []string
+	CacheMaxVersions        int
+	CacheMaxSizeMB          int
+	PluginCacheEnabled      bool
+	PluginCacheDir          string
+	PluginCacheStorageKey   string
+	InitUpgrade             bool
+	ApplyRequirePlan        bool
+
+	ProviderNetworkMirrorURL        string
+	ProviderNetworkMirrorInclude    []string
+	ProviderNetworkMirrorExclude    []string
+	ProviderFilesystemMirrorPath    string
+	ProviderFilesystemMirrorInclude []string
+	ProviderFilesystemMirrorExclude []string
+	ProviderDirectEnabled           bool
+	ProviderDirectInclude           []string
+	ProviderDirectExclude           []string
 }
 
 func getEnvWithFallback(primary, fallback string) string {
@@ -28,6 +78,57 @@ func getEnvWithFallback(primary, fallback string) string {
 	return val
 }
 
+func getEnvWithDefault(name, defaultValue string) string {
+	val := os.Getenv(name)
+	if val == "" {
+		return defaultValue
+	}
+	return val
+}
+
+func getEnvList(name string, defaultValue []string) []string {
+	val := os.Getenv(name)
+	if val == "" {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvInt parses an integer variable, adding an error to errs if it is set to something else
+func getEnvInt(name string, defaultValue int, errs *[]error) int {
+	val := os.Getenv(name)
+	if val == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(val)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("invalid %s %q: not an integer", name, val))
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDuration parses a duration variable such as 90s or 1h30m, adding an
+// error to errs if it is set to something else or is negative
+func getEnvDuration(name string, defaultValue time.Duration, errs *[]error) time.Duration {
+	val := os.Getenv(name)
+	if val == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(val)
+	if err != nil || parsed < 0 {
+		*errs = append(*errs, fmt.Errorf("invalid %s %q: not a duration such as 90s or 1h30m", name, val))
+		return defaultValue
+	}
+	return parsed
+}
+
 func getStorageType() string {
 	st := os.Getenv("STORAGE_TYPE")
 	if st != "" {
@@ -48,12 +149,71 @@ func getStorageType() string {
 }
 
 func LoadConfig() (*Config, error) {
+	var errs []error
 	cfg := &Config{
 		Mode:                    os.Getenv("EXECUTOR_MODE"),
 		TerrakubeApiUrl:         getEnvWithFallback("TERRAKUBE_API_URL", "TerrakubeApiUrl"),
 		TerrakubeRegistryDomain: getEnvWithFallback("TERRAKUBE_REGISTRY_DOMAIN", "TerrakubeRegistryDomain"),
 		InternalSecret:          getEnvWithFallback("TERRAKUBE_INTERNAL_SECRET", "InternalSecret"),
 		StorageType:             getStorageType(),
+		WorkerCount:             getEnvInt("EXECUTOR_WORKERS", 4, &errs),
+		QueueSize:               getEnvInt("EXECUTOR_QUEUE_SIZE", 100, &errs),
+		CancelGracePeriod:       getEnvDuration("EXECUTOR_CANCEL_GRACE_PERIOD", 30*time.Second, &errs),
+		JobTimeout:              getEnvDuration("EXECUTOR_JOB_TIMEOUT", 6*time.Hour, &errs),
+		CloneTimeout:            getEnvDuration("EXECUTOR_CLONE_TIMEOUT", 10*time.Minute, &errs),
+		InstallTimeout:          getEnvDuration("EXECUTOR_INSTALL_TIMEOUT", 10*time.Minute, &errs),
+		InitTimeout:             getEnvDuration("EXECUTOR_INIT_TIMEOUT", 0, &errs),
+		ExecutionTimeout:        getEnvDuration("EXECUTOR_EXECUTION_TIMEOUT", 0, &errs),
+		ScriptTimeout:           getEnvDuration("EXECUTOR_SCRIPT_TIMEOUT", 0, &errs),
+		DrainTimeout:            getEnvDuration("EXECUTOR_DRAIN_TIMEOUT", 5*time.Minute, &errs),
+		JobHistorySize:          getEnvInt("EXECUTOR_JOB_HISTORY_SIZE", 100, &errs),
+		LogBufferKB:             getEnvInt("EXECUTOR_LOG_BUFFER_KB", 1024, &errs),
+		LogHistoryKB:            getEnvInt("EXECUTOR_LOG_HISTORY_KB", 64, &errs),
+		TokenTTL:                getEnvDuration("TERRAKUBE_TOKEN_TTL", 6*time.Hour, &errs),
+		AuthEnabled:             os.Getenv("EXECUTOR_AUTH_ENABLED") != "false",
+		TLSCertFile:             os.Getenv("EXECUTOR_TLS_CERT_FILE"),
+		TLSKeyFile:              os.Getenv("EXECUTOR_TLS_KEY_FILE"),
+		TLSClientCAFile:         os.Getenv("EXECUTOR_TLS_CLIENT_CA_FILE"),
+		SSHKnownHostsFile:       os.Getenv("GIT_SSH_KNOWN_HOSTS_FILE"),
+		SSHStrictHostKeyCheck:   os.Getenv("GIT_SSH_STRICT_HOST_KEY_CHECKING"),
+		TofuGPGKeyFile:          os.Getenv("TOFU_GPG_KEY_FILE"),
+		TofuGPGKeyURL:           getEnvWithDefault("TOFU_GPG_KEY_URL", "https://get.opentofu.org/opentofu.asc"),
+		TofuGPGKeyFingerprint:   getEnvWithDefault("TOFU_GPG_KEY_FINGERPRINT", "E3E6E43D84CB852EADB0051D0C0AF313E5FD9F80"),
+		VersionIndexOffline:     os.Getenv("TERRAFORM_VERSION_INDEX_OFFLINE") == "true",
+		VersionIndexTTL:         getEnvDuration("TERRAFORM_VERSION_INDEX_TTL", time.Hour, &errs),
+		BinaryLocalDir:          os.Getenv("TERRAFORM_BINARY_LOCAL_DIR"),
+		BinaryMirrorURL:         os.Getenv("TERRAFORM_BINARY_MIRROR_URL"),
+		BinaryStoragePrefix:     os.Getenv("TERRAFORM_BINARY_STORAGE_PREFIX"),
+		BinarySources:           getEnvList("TERRAFORM_BINARY_SOURCES", []string{"local", "mirror", "storage", "releases"}),
+		CacheMaxVersions:        getEnvInt("TERRAFORM_CACHE_MAX_VERSIONS", 0, &errs),
+		CacheMaxSizeMB:          getEnvInt("TERRAFORM_CACHE_MAX_SIZE_MB", 0, &errs),
+		PluginCacheEnabled:      os.Getenv("TERRAFORM_PLUGIN_CACHE_ENABLED") != "false",
+		PluginCacheDir:          os.Getenv("TERRAFORM_PLUGIN_CACHE_DIR"),
+		PluginCacheStorageKey:   os.Getenv("TERRAFORM_PLUGIN_CACHE_STORAGE_KEY"),
+		InitUpgrade:             os.Getenv("TERRAFORM_INIT_UPGRADE") != "false",
+		ApplyRequirePlan:        os.Getenv("TERRAFORM_APPLY_REQUIRE_PLAN") == "true",
+
+		ProviderNetworkMirrorURL:        os.Getenv("TERRAFORM_PROVIDER_NETWORK_MIRROR_URL"),
+		ProviderNetworkMirrorInclude:    getEnvList("TERRAFORM_PROVIDER_NETWORK_MIRROR_INCLUDE", nil),
+		ProviderNetworkMirrorExclude:    getEnvList("TERRAFORM_PROVIDER_NETWORK_MIRROR_EXCLUDE", nil),
+		ProviderFilesystemMirrorPath:    os.Getenv("TERRAFORM_PROVIDER_FILESYSTEM_MIRROR_PATH"),
+		ProviderFilesystemMirrorInclude: getEnvList("TERRAFORM_PROVIDER_FILESYSTEM_MIRROR_INCLUDE", nil),
+		ProviderFilesystemMirrorExclude: getEnvList("TERRAFORM_PROVIDER_FILESYSTEM_MIRROR_EXCLUDE", nil),
+		ProviderDirectEnabled:           os.Getenv("TERRAFORM_PROVIDER_DIRECT_ENABLED") != "false",
+		ProviderDirectInclude:           getEnvList("TERRAFORM_PROVIDER_DIRECT_INCLUDE", nil),
+		ProviderDirectExclude:           getEnvList("TERRAFORM_PROVIDER_DIRECT_EXCLUDE", nil),
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if cfg.SSHStrictHostKeyCheck == "" {
+		// Without a managed known_hosts file, trust hosts on first use
+		cfg.SSHStrictHostKeyCheck = "accept-new"
+		if cfg.SSHKnownHostsFile != "" {
+			cfg.SSHStrictHostKeyCheck = "yes"
+		}
 	}
 
 	if cfg.Mode == "BATCH" {
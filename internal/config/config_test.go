@@ -0,0 +1,67 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigNumbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr []string
+	}{
+		{
+			name: "valid",
+			env:  map[string]string{"EXECUTOR_WORKERS": "8", "EXECUTOR_DRAIN_TIMEOUT": "90s"},
+		},
+		{
+			name:    "invalid integer",
+			env:     map[string]string{"EXECUTOR_WORKERS": "eight"},
+			wantErr: []string{"EXECUTOR_WORKERS"},
+		},
+		{
+			name:    "duration without unit",
+			env:     map[string]string{"EXECUTOR_DRAIN_TIMEOUT": "300"},
+			wantErr: []string{"EXECUTOR_DRAIN_TIMEOUT"},
+		},
+		{
+			name:    "negative duration",
+			env:     map[string]string{"EXECUTOR_JOB_TIMEOUT": "-1h"},
+			wantErr: []string{"EXECUTOR_JOB_TIMEOUT"},
+		},
+		{
+			name:    "every invalid value is reported",
+			env:     map[string]string{"EXECUTOR_QUEUE_SIZE": "1e3", "TERRAKUBE_TOKEN_TTL": "1d"},
+			wantErr: []string{"EXECUTOR_QUEUE_SIZE", "TERRAKUBE_TOKEN_TTL"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := LoadConfig()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if cfg.WorkerCount != 8 || cfg.DrainTimeout != 90*time.Second {
+					t.Errorf("got %d workers and drain timeout %s", cfg.WorkerCount, cfg.DrainTimeout)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, name := range tt.wantErr {
+				if !strings.Contains(err.Error(), name) {
+					t.Errorf("error %q does not name %s", err, name)
+				}
+			}
+		})
+	}
+}
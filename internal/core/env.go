@@ -0,0 +1,50 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+// buildEnv returns the environment shared by terraform and custom scripts: the
+// executor environment, the job environment variables, the terraform variables
+// as TF_VAR_* and well-known variables describing the job. Sensitive terraform
+// variables are left out, terraform reads them from the variables file.
+func (p *JobProcessor) buildEnv(job *model.TerraformJob, workingDir, cliConfigPath, execPath, token string) map[string]string {
+	env := make(map[string]string)
+
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	for k, v := range job.EnvironmentVariables {
+		env[k] = v
+	}
+	for k, v := range job.Variables {
+		if v.Sensitive {
+			continue
+		}
+		env[fmt.Sprintf("TF_VAR_%s", k)] = v.Value
+	}
+
+	env["TERRAKUBE_ORGANIZATION_ID"] = job.OrganizationId
+	env["TERRAKUBE_WORKSPACE_ID"] = job.WorkspaceId
+	env["TERRAKUBE_JOB_ID"] = job.JobId
+	env["TERRAKUBE_STEP_ID"] = job.StepId
+	env["TERRAKUBE_WORKING_DIRECTORY"] = workingDir
+	env["TERRAKUBE_API_URL"] = p.Config.TerrakubeApiUrl
+	if token != "" {
+		env["TERRAKUBE_TOKEN"] = token
+	}
+	if execPath != "" {
+		env["TERRAFORM_PATH"] = execPath
+		env["TERRAFORM_VERSION"] = job.TerraformVersion
+	}
+	env["TF_CLI_CONFIG_FILE"] = cliConfigPath
+
+	return env
+}
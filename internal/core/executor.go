@@ -2,12 +2,17 @@ package core
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ilkerispir/terrakube-executor/internal/auth"
 	"github.com/ilkerispir/terrakube-executor/internal/config"
@@ -20,11 +25,29 @@ import (
 	"github.com/ilkerispir/terrakube-executor/internal/workspace"
 )
 
+// ErrJobCancelled is the cancellation cause used when a job is cancelled on request
+var ErrJobCancelled = errors.New("job cancelled")
+
+// ErrShuttingDown is the cancellation cause used when the executor stops before a job finished
+var ErrShuttingDown = errors.New("executor shutting down")
+
 type JobProcessor struct {
 	Status         status.StatusService
 	Config         *config.Config
 	Storage        storage.StorageService
 	VersionManager *terraform.VersionManager
+	// PluginCache is nil when the shared provider plugin cache is disabled
+	PluginCache *terraform.PluginCache
+	Tracker     *JobTracker
+
+	mu      sync.Mutex
+	running map[string]*runningJob
+}
+
+// runningJob is an entry of JobProcessor.running, compared by address so that
+// a finishing job never removes the entry of a later job with the same id
+type runningJob struct {
+	cancel context.CancelCauseFunc
 }
 
 func NewJobProcessor(cfg *config.Config, status status.StatusService, storage storage.StorageService) *JobProcessor {
@@ -32,7 +55,56 @@ func NewJobProcessor(cfg *config.Config, status status.StatusService, storage st
 		Config:         cfg,
 		Status:         status,
 		Storage:        storage,
-		VersionManager: terraform.NewVersionManager(),
+		VersionManager: terraform.NewVersionManager(cfg, storage),
+		PluginCache:    terraform.NewPluginCache(cfg, storage),
+		Tracker:        NewJobTracker(cfg.JobHistorySize),
+		running:        make(map[string]*runningJob),
+	}
+}
+
+// CancelJob cancels a running job, returning false if the job is not running
+func (p *JobProcessor) CancelJob(jobId string) bool {
+	p.mu.Lock()
+	job, ok := p.running[jobId]
+	p.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	log.Printf("Cancelling Job: %s", jobId)
+	job.cancel(ErrJobCancelled)
+	return true
+}
+
+// CancelAll cancels every running job with the given cause and returns how many were cancelled
+func (p *JobProcessor) CancelAll(cause error) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for jobId, job := range p.running {
+		log.Printf("Cancelling Job %s: %v", jobId, cause)
+		job.cancel(cause)
+	}
+	return len(p.running)
+}
+
+// Track registers a job as running so that CancelJob and CancelAll reach it,
+// returning the context to run it with and a function to call once it is done
+func (p *JobProcessor) Track(ctx context.Context, jobId string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	job := &runningJob{cancel: cancel}
+
+	p.mu.Lock()
+	p.running[jobId] = job
+	p.mu.Unlock()
+
+	return ctx, func() {
+		p.mu.Lock()
+		if p.running[jobId] == job {
+			delete(p.running, jobId)
+		}
+		p.mu.Unlock()
+		cancel(nil)
 	}
 }
 
@@ -47,57 +119,116 @@ func stripScheme(domain string) string {
 	return domain
 }
 
-func (p *JobProcessor) generateTerraformCredentials(job *model.TerraformJob, workingDir string) error {
-	var token string
-	log.Printf("generateTerraformCredentials: checking InternalSecret (len: %d)", len(p.Config.InternalSecret))
-	if p.Config.InternalSecret != "" {
-		t, err := auth.GenerateTerrakubeToken(p.Config.InternalSecret)
-		if err != nil {
-			log.Printf("Warning: failed to generate Terrakube token for .terraformrc: %v", err)
-		} else {
-			token = t
-			log.Printf("generateTerraformCredentials: token generated successfully")
-		}
-	} else {
-		log.Printf("Warning: InternalSecret is empty, skipping token generation")
+// tokenMargin keeps a job token valid while the result of a job that ran
+// into its timeout is reported
+const tokenMargin = 15 * time.Minute
+
+// statusTokenTTL is the lifetime of the tokens the executor uses itself, they
+// are renewed as needed
+const statusTokenTTL = time.Hour
+
+// newTokenSource returns the token source of a job
+func (p *JobProcessor) newTokenSource(job *model.TerraformJob) *auth.TokenSource {
+	scope := auth.JobScope{
+		OrganizationId: job.OrganizationId,
+		WorkspaceId:    job.WorkspaceId,
+		JobId:          job.JobId,
 	}
+	return auth.NewTokenSource(p.Config.InternalSecret, scope, statusTokenTTL)
+}
 
-	if token == "" {
-		return nil
+// JobToken returns a token to report the status of a job that is not processed
+func (p *JobProcessor) JobToken(job *model.TerraformJob) string {
+	return p.jobToken(p.newTokenSource(job))
+}
+
+// jobToken returns the current Terrakube token of the job, empty if it cannot be generated
+func (p *JobProcessor) jobToken(tokens *auth.TokenSource) string {
+	token, err := tokens.Token()
+	if err != nil {
+		log.Printf("Warning: failed to generate Terrakube token: %v", err)
+		return ""
 	}
+	return token
+}
 
-	content := ""
+// phaseToken returns a token for terraform or scripts that outlives the phase
+// about to run: its timeout, or the job deadline of ctx if it comes first.
+// Without either, the configured token TTL applies.
+func (p *JobProcessor) phaseToken(ctx context.Context, tokens *auth.TokenSource, timeout time.Duration) string {
+	d := timeout
+	if deadline, ok := ctx.Deadline(); ok && (d <= 0 || time.Until(deadline) < d) {
+		d = time.Until(deadline)
+	}
+	if d <= 0 {
+		d = p.Config.TokenTTL
+	}
 
-	registryHost := stripScheme(p.Config.TerrakubeRegistryDomain)
-	if registryHost != "" {
-		content += fmt.Sprintf("credentials \"%s\" {\n  token = \"%s\"\n}\n", registryHost, token)
-		log.Printf("generateTerraformCredentials: added credentials for registryHost: %s", registryHost)
+	token, err := tokens.TokenValidFor(d + tokenMargin)
+	if err != nil {
+		log.Printf("Warning: failed to generate Terrakube token: %v", err)
+		return ""
 	}
+	return token
+}
+
+// cliConfig returns the terraform CLI configuration of a job: credentials for
+// the Terrakube registry and API, and the provider installation methods
+func (p *JobProcessor) cliConfig(token string) *terraform.CLIConfig {
+	cfg := &terraform.CLIConfig{Credentials: make(map[string]string)}
+
+	if token != "" {
+		registryHost := stripScheme(p.Config.TerrakubeRegistryDomain)
+		if registryHost != "" {
+			cfg.Credentials[registryHost] = token
+			log.Printf("cliConfig: added credentials for registryHost: %s", registryHost)
+		}
 
-	if p.Config.TerrakubeApiUrl != "" {
-		parsedUrl, err := url.Parse(p.Config.TerrakubeApiUrl)
-		if err == nil && parsedUrl.Hostname() != "" {
-			apiHost := parsedUrl.Hostname()
-			if apiHost != registryHost {
-				content += fmt.Sprintf("credentials \"%s\" {\n  token = \"%s\"\n}\n", apiHost, token)
-				log.Printf("generateTerraformCredentials: added credentials for apiHost: %s", apiHost)
+		if p.Config.TerrakubeApiUrl != "" {
+			parsedUrl, err := url.Parse(p.Config.TerrakubeApiUrl)
+			if err == nil && parsedUrl.Hostname() != "" && parsedUrl.Hostname() != registryHost {
+				cfg.Credentials[parsedUrl.Hostname()] = token
+				log.Printf("cliConfig: added credentials for apiHost: %s", parsedUrl.Hostname())
 			}
 		}
 	}
 
-	if content == "" {
-		log.Printf("generateTerraformCredentials: no credentials generated, returning")
-		return nil
+	if p.Config.ProviderNetworkMirrorURL != "" {
+		cfg.Installation = append(cfg.Installation, terraform.InstallationMethod{
+			Type:     terraform.NetworkMirror,
+			Location: p.Config.ProviderNetworkMirrorURL,
+			Include:  p.Config.ProviderNetworkMirrorInclude,
+			Exclude:  p.Config.ProviderNetworkMirrorExclude,
+		})
 	}
-
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return err
+	if p.Config.ProviderFilesystemMirrorPath != "" {
+		cfg.Installation = append(cfg.Installation, terraform.InstallationMethod{
+			Type:     terraform.FilesystemMirror,
+			Location: p.Config.ProviderFilesystemMirrorPath,
+			Include:  p.Config.ProviderFilesystemMirrorInclude,
+			Exclude:  p.Config.ProviderFilesystemMirrorExclude,
+		})
+	}
+	// Declaring any method disables the default installation, so direct is
+	// added back unless it was turned off
+	if len(cfg.Installation) > 0 && p.Config.ProviderDirectEnabled {
+		cfg.Installation = append(cfg.Installation, terraform.InstallationMethod{
+			Type:    terraform.Direct,
+			Include: p.Config.ProviderDirectInclude,
+			Exclude: p.Config.ProviderDirectExclude,
+		})
 	}
 
-	rcPath := filepath.Join(homeDir, ".terraformrc")
-	log.Printf("generateTerraformCredentials: writing HCL credentials to %s", rcPath)
-	return os.WriteFile(rcPath, []byte(content), 0644)
+	return cfg
+}
+
+// generateCLIConfig writes the job's CLI configuration to path. The file is
+// written even when empty so that terraform does not fall back to a shared
+// configuration in the home directory.
+func (p *JobProcessor) generateCLIConfig(path string, token string) error {
+	content := p.cliConfig(token).Render()
+	log.Printf("generateCLIConfig: writing CLI configuration to %s", path)
+	return os.WriteFile(path, []byte(content), 0600)
 }
 
 func (p *JobProcessor) generateBackendOverride(job *model.TerraformJob, workingDir string) error {
@@ -137,15 +268,43 @@ func (p *JobProcessor) generateBackendOverride(job *model.TerraformJob, workingD
 	return os.WriteFile(overridePath, []byte(overrideContent), 0644)
 }
 
-func (p *JobProcessor) ProcessJob(job *model.TerraformJob) error {
+// ProcessJob runs a job and reports its result
+func (p *JobProcessor) ProcessJob(ctx context.Context, job *model.TerraformJob) error {
+	ctx, done := p.Track(ctx, job.JobId)
+	defer done()
+	return p.ProcessTracked(ctx, job)
+}
+
+// ProcessTracked runs a job whose context was returned by Track
+func (p *JobProcessor) ProcessTracked(ctx context.Context, job *model.TerraformJob) (err error) {
 	log.Printf("Processing Job: %s", job.JobId)
 
+	// A panicking job is reported as failed instead of being left running
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v\n%s", job.JobId, r, debug.Stack())
+			err = fmt.Errorf("job panicked: %v", r)
+			p.Tracker.Finish(job, ResultFailed, err)
+			if statusErr := p.Status.SetCompleted(context.WithoutCancel(ctx), job, p.JobToken(job), false, "Error: "+err.Error()); statusErr != nil {
+				log.Printf("Failed to set completed status: %v", statusErr)
+			}
+		}
+	}()
+
+	tokens := p.newTokenSource(job)
+
 	// 1. Update Status to Running
-	if err := p.Status.SetRunning(job); err != nil {
+	token := p.jobToken(tokens)
+	if err := p.Status.SetRunning(ctx, job, token); err != nil {
 		log.Printf("Failed to set running status: %v", err)
 	}
 
 	// 2. Setup Logging
+	redactor := p.newRedactor(job, token)
+	tokens.OnRefresh(func(token string) {
+		redactor.Add(token)
+	})
+
 	var baseStreamer logs.LogStreamer
 	if os.Getenv("USE_REDIS_LOGS") == "true" {
 		baseStreamer = logs.NewRedisStreamer(os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PASSWORD"), job.JobId, job.StepId)
@@ -153,69 +312,124 @@ func (p *JobProcessor) ProcessJob(job *model.TerraformJob) error {
 		baseStreamer = &logs.ConsoleStreamer{}
 	}
 
+	// The output buffer lets the API replay and follow the redacted logs. Once
+	// the job is done, only its tail is kept in the job history.
+	outputBuffer := logs.NewLogBuffer(p.Config.LogBufferKB * 1024)
+	defer func() {
+		outputBuffer.Close()
+		outputBuffer.Shrink(p.Config.LogHistoryKB * 1024)
+	}()
+	p.Tracker.SetLogs(job, outputBuffer)
+
 	var logBuffer bytes.Buffer
-	streamer := logs.NewMultiStreamer(baseStreamer, &logBuffer)
+	streamer := logs.NewRedactingStreamer(logs.NewMultiStreamer(baseStreamer, &logBuffer, outputBuffer), redactor)
 	defer streamer.Close()
 
+	timeouts, err := resolveTimeouts(p.Config, job)
+	if err != nil {
+		p.reportResult(ctx, job, tokens, redactor, "", err)
+		return err
+	}
+	ctx, cancelTimeout := withJobTimeout(ctx, timeouts.Job)
+	defer cancelTimeout()
+
 	// 3. Setup Workspace
-	ws := workspace.NewWorkspace(job)
-	workingDir, err := ws.Setup()
+	p.Tracker.SetState(job, StateCloning)
+	ws := workspace.NewWorkspace(job, p.Config)
+	var workingDir string
+	err = runPhase(ctx, "git clone", timeouts.Clone, func(ctx context.Context) (err error) {
+		workingDir, err = ws.Setup(ctx)
+		return err
+	})
 	if err != nil {
-		p.Status.SetCompleted(job, false, err.Error())
-		return fmt.Errorf("failed to setup workspace: %w", err)
+		err = fmt.Errorf("failed to setup workspace: %w", err)
+		p.reportResult(ctx, job, tokens, redactor, "", err)
+		return err
 	}
 	defer ws.Cleanup()
 
+	cliConfigPath := ws.CLIConfigPath()
+	if err := p.generateCLIConfig(cliConfigPath, token); err != nil {
+		err = fmt.Errorf("failed to generate terraform CLI configuration: %w", err)
+		p.reportResult(ctx, job, tokens, redactor, "", err)
+		return err
+	}
+
 	// 4. Download Pre-existing State/Plan if needed
-	// TODO: If APPLY, download PLAN
 	// TODO: If PLAN/APPLY/DESTROY, download STATE (if not using remote backend)
 
 	// 5. Execute Command
 	var executionErr error
 	switch job.Type {
 	case "terraformPlan", "terraformApply", "terraformDestroy":
-		// Install/Get execution path for the specific version
-		execPath, err := p.VersionManager.Install(job.TerraformVersion)
-		if err != nil {
-			executionErr = fmt.Errorf("failed to install terraform %s: %w", job.TerraformVersion, err)
-			break
+		executionErr = p.executeTerraform(ctx, job, ws, workingDir, streamer, tokens, redactor, timeouts)
+	case "customScripts", "approval":
+		// Scripts can run terraform through TERRAFORM_PATH when the job selects a version
+		var execPath string
+		if job.Type == "customScripts" && job.TerraformVersion != "" {
+			var release func()
+			execPath, release, executionErr = p.installTool(ctx, job, workingDir, timeouts.Install)
+			if executionErr != nil {
+				break
+			}
+			defer release()
 		}
 
-		if err := p.generateBackendOverride(job, workingDir); err != nil {
-			executionErr = fmt.Errorf("failed to generate backend override: %w", err)
+		p.Tracker.SetState(job, StateRunning)
+		scriptToken := p.phaseToken(ctx, tokens, timeouts.Scripts)
+		if executionErr = p.generateCLIConfig(cliConfigPath, scriptToken); executionErr != nil {
 			break
 		}
+		env := p.buildEnv(job, workingDir, cliConfigPath, execPath, scriptToken)
+		scriptExecutor := script.NewExecutor(job, workingDir, streamer, env, p.Config.CancelGracePeriod)
+		scriptExecutor.ScriptDir = ws.ScriptDir()
+		executionErr = runPhase(ctx, "scripts", timeouts.Scripts, scriptExecutor.Execute)
+	default:
+		executionErr = fmt.Errorf("unknown job type: %s", job.Type)
+	}
 
-		if err := p.generateTerraformCredentials(job, workingDir); err != nil {
-			executionErr = fmt.Errorf("failed to generate terraform credentials: %w", err)
-			break
-		}
+	// 6. Update Status to Completed/Failed/Cancelled
+	streamer.Flush()
+	p.reportResult(ctx, job, tokens, redactor, logBuffer.String(), executionErr)
+
+	return executionErr
+}
 
-		tfExecutor := terraform.NewExecutor(job, workingDir, streamer, execPath)
-		executionErr = tfExecutor.Execute()
+// reportResult sends the final step status, reporting the job as cancelled
+// when its context was cancelled through CancelJob. The status is sent even
+// when ctx is done.
+func (p *JobProcessor) reportResult(ctx context.Context, job *model.TerraformJob, tokens *auth.TokenSource, redactor *logs.Redactor, output string, executionErr error) {
+	reportCtx := context.WithoutCancel(ctx)
+	token := p.jobToken(tokens)
 
-		// Upload State and Output
-		if executionErr == nil {
-			p.uploadStateAndOutput(job, workingDir)
+	if executionErr != nil && errors.Is(context.Cause(ctx), ErrShuttingDown) && !errors.Is(executionErr, ErrShuttingDown) {
+		executionErr = fmt.Errorf("%w: %v", ErrShuttingDown, executionErr)
+	}
+
+	if executionErr != nil {
+		if output != "" {
+			output += "\n"
 		}
+		output += "Error: " + executionErr.Error()
+	}
+	output = redactor.Redact(output)
 
-	case "customScripts", "approval":
-		scriptExecutor := script.NewExecutor(job, workingDir, streamer)
-		executionErr = scriptExecutor.Execute()
-	default:
-		executionErr = fmt.Errorf("unknown job type: %s", job.Type)
+	if errors.Is(context.Cause(ctx), ErrJobCancelled) {
+		log.Printf("Job %s was cancelled", job.JobId)
+		p.Tracker.Finish(job, ResultCancelled, executionErr)
+		if err := p.Status.SetCancelled(reportCtx, job, token, output); err != nil {
+			log.Printf("Failed to set cancelled status: %v", err)
+		}
+		return
 	}
 
-	// 6. Update Status to Completed/Failed
-	success := executionErr == nil
-	output := logBuffer.String()
+	result := ResultCompleted
 	if executionErr != nil {
-		output += "\nError: " + executionErr.Error()
+		result = ResultFailed
 	}
+	p.Tracker.Finish(job, result, executionErr)
 
-	if err := p.Status.SetCompleted(job, success, output); err != nil {
+	if err := p.Status.SetCompleted(reportCtx, job, token, executionErr == nil, output); err != nil {
 		log.Printf("Failed to set completed status: %v", err)
 	}
-
-	return executionErr
 }
@@ -0,0 +1,196 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ilkerispir/terrakube-executor/internal/auth"
+	"github.com/ilkerispir/terrakube-executor/internal/logs"
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+	"github.com/ilkerispir/terrakube-executor/internal/script"
+	"github.com/ilkerispir/terrakube-executor/internal/terraform"
+	"github.com/ilkerispir/terrakube-executor/internal/workspace"
+)
+
+// terraformPhases maps the terraform job types to the name of their main phase,
+// as used by before/after hooks
+var terraformPhases = map[string]string{
+	"terraformPlan":    "plan",
+	"terraformApply":   "apply",
+	"terraformDestroy": "destroy",
+}
+
+// terraformStates maps the terraform job types to the tracked state of their main phase
+var terraformStates = map[string]string{
+	"terraformPlan":    StatePlanning,
+	"terraformApply":   StateApplying,
+	"terraformDestroy": StateDestroying,
+}
+
+// jobTool returns the CLI selected by the job, terraform unless it asks for OpenTofu
+func jobTool(job *model.TerraformJob) terraform.Tool {
+	if job.Tofu {
+		return terraform.OpenTofu
+	}
+	return terraform.Terraform
+}
+
+// installTool resolves the job's version, read from the configuration when the
+// job leaves it empty, and installs it. The job is updated with the exact version.
+// The binary stays in the cache until release is called.
+func (p *JobProcessor) installTool(ctx context.Context, job *model.TerraformJob, workingDir string, timeout time.Duration) (execPath string, release func(), err error) {
+	tool := jobTool(job)
+	spec := job.TerraformVersion
+
+	err = runPhase(ctx, "terraform install", timeout, func(ctx context.Context) error {
+		if spec == "" {
+			detected, err := terraform.DetectVersion(tool, workingDir)
+			if err != nil {
+				return err
+			}
+			spec = detected
+		}
+
+		ver, err := p.VersionManager.Resolve(ctx, tool, spec)
+		if err != nil {
+			return err
+		}
+		execPath, release, err = p.VersionManager.Install(ctx, tool, ver)
+		if err != nil {
+			return err
+		}
+		job.TerraformVersion = ver
+		return nil
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to install %s %s: %w", tool, spec, err)
+	}
+	return execPath, release, nil
+}
+
+func (p *JobProcessor) executeTerraform(ctx context.Context, job *model.TerraformJob, ws *workspace.Workspace, workingDir string, streamer logs.LogStreamer, tokens *auth.TokenSource, redactor *logs.Redactor, timeouts jobTimeouts) error {
+	mainPhase := terraformPhases[job.Type]
+	if err := script.ValidateHooks(job.CommandList, mainPhase); err != nil {
+		return err
+	}
+
+	// Installing the binary and generating the configuration are tracked as part of init
+	p.Tracker.SetState(job, StateInit)
+
+	// Install/Get execution path for the specific version
+	execPath, release, err := p.installTool(ctx, job, workingDir, timeouts.Install)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := p.generateBackendOverride(job, workingDir); err != nil {
+		return fmt.Errorf("failed to generate backend override: %w", err)
+	}
+
+	if err := terraform.GenerateVariablesFile(workingDir, job.Variables); err != nil {
+		return fmt.Errorf("failed to generate variables file: %w", err)
+	}
+
+	cliConfigPath := ws.CLIConfigPath()
+	env := p.buildEnv(job, workingDir, cliConfigPath, execPath, "")
+	tfExecutor := terraform.NewExecutor(job, workingDir, streamer, execPath, env, p.Config.CancelGracePeriod)
+	tfExecutor.Upgrade = p.Config.InitUpgrade
+	if job.Type == "terraformApply" {
+		if job.PlanStepId == "" {
+			job.PlanStepId = p.latestPlanStep(job)
+		}
+		if job.PlanStepId != "" {
+			tfExecutor.PlanFile, err = p.downloadPlan(job, workingDir)
+			if err != nil {
+				return err
+			}
+		} else if p.Config.ApplyRequirePlan {
+			return fmt.Errorf("terraformApply requires planStepId or a plan saved by a terraformPlan step of the job")
+		} else {
+			log.Printf("Warning: no saved plan for job %s, applying without a plan", job.JobId)
+		}
+	}
+
+	// Terraform and scripts cannot pick up a new token while they run, so
+	// before each phase they get a token that outlives it
+	var token string
+	refreshToken := func(timeout time.Duration) error {
+		current := p.phaseToken(ctx, tokens, timeout)
+		if current == token || current == "" {
+			return nil
+		}
+		token = current
+		env["TERRAKUBE_TOKEN"] = token
+		if err := p.generateCLIConfig(cliConfigPath, token); err != nil {
+			return fmt.Errorf("failed to refresh terraform CLI configuration: %w", err)
+		}
+		return nil
+	}
+
+	hooks := script.NewExecutor(job, workingDir, streamer, env, p.Config.CancelGracePeriod)
+	hooks.ScriptDir = ws.ScriptDir()
+	runHooks := func(placement, phase string) error {
+		if err := refreshToken(timeouts.Scripts); err != nil {
+			return err
+		}
+		return runPhase(ctx, "scripts", timeouts.Scripts, func(ctx context.Context) error {
+			return hooks.RunHooks(ctx, placement, phase, mainPhase)
+		})
+	}
+
+	if err := runHooks(script.Before, "init"); err != nil {
+		return err
+	}
+	init := tfExecutor.Init
+	if p.PluginCache != nil {
+		init = func(ctx context.Context) error {
+			return p.PluginCache.Run(ctx, workingDir, func(ctx context.Context, cacheDir string) error {
+				tfExecutor.PluginCacheDir = cacheDir
+				defer func() { tfExecutor.PluginCacheDir = "" }()
+				return tfExecutor.Init(ctx)
+			})
+		}
+	}
+	if err := refreshToken(timeouts.Init); err != nil {
+		return err
+	}
+	if err := runPhase(ctx, "terraform init", timeouts.Init, init); err != nil {
+		return err
+	}
+	if err := runHooks(script.After, "init"); err != nil {
+		return err
+	}
+
+	p.Tracker.SetState(job, terraformStates[job.Type])
+	if err := runHooks(script.Before, mainPhase); err != nil {
+		return err
+	}
+	if err := refreshToken(timeouts.Execution); err != nil {
+		return err
+	}
+	if err := runPhase(ctx, job.Type, timeouts.Execution, tfExecutor.Run); err != nil {
+		return err
+	}
+
+	if job.HasChanges != nil && !*job.HasChanges {
+		log.Printf("Plan for job %s has no changes", job.JobId)
+	}
+	if job.Type == "terraformPlan" {
+		if err := p.savePlanJSON(ctx, job, tfExecutor); err != nil {
+			log.Printf("Failed to save plan JSON: %v", err)
+		}
+	}
+
+	// Upload State and Output
+	p.Tracker.SetState(job, StateUploading)
+	if err := refreshToken(timeouts.Execution); err != nil {
+		return err
+	}
+	p.uploadStateAndOutput(ctx, job, workingDir, execPath, env)
+	job.TerraformOutput = redactor.Redact(job.TerraformOutput)
+
+	return runHooks(script.After, mainPhase)
+}
@@ -1,16 +1,103 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/ilkerispir/terrakube-executor/internal/model"
 	"github.com/ilkerispir/terrakube-executor/internal/terraform"
 )
 
-func (p *JobProcessor) uploadStateAndOutput(job *model.TerraformJob, workingDir string) {
+func planPath(job *model.TerraformJob, stepId string) string {
+	return fmt.Sprintf("organization/%s/workspace/%s/job/%s/step/%s/terraformLibrary.tfplan", job.OrganizationId, job.WorkspaceId, job.JobId, stepId)
+}
+
+// latestPlanStepPath is where the id of the last terraformPlan step of a job
+// that saved a plan is stored, for applies that do not name their plan step
+func latestPlanStepPath(job *model.TerraformJob) string {
+	return fmt.Sprintf("organization/%s/workspace/%s/job/%s/latestPlanStep", job.OrganizationId, job.WorkspaceId, job.JobId)
+}
+
+// latestPlanStep returns the last plan step of the job that saved a plan, empty if there is none
+func (p *JobProcessor) latestPlanStep(job *model.TerraformJob) string {
+	rc, err := p.Storage.DownloadFile(latestPlanStepPath(job))
+	if err != nil || rc == nil {
+		return ""
+	}
+	defer rc.Close()
+
+	stepId, err := io.ReadAll(rc)
+	if err != nil {
+		log.Printf("Failed to read the latest plan step of job %s: %v", job.JobId, err)
+		return ""
+	}
+	return strings.TrimSpace(string(stepId))
+}
+
+// savePlanJSON uploads the JSON representation of the saved plan next to the
+// plan file, along with the change summary
+func (p *JobProcessor) savePlanJSON(ctx context.Context, job *model.TerraformJob, tfExecutor *terraform.Executor) error {
+	// The uploaded JSON is terraform's own output, the parsed plan is only used for the summary
+	plan, planJson, err := tfExecutor.ShowPlan(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Path: organization/{orgId}/workspace/{workspaceId}/job/{jobId}/step/{stepId}/terraformLibrary.tfplan.json
+	if err := p.Storage.UploadFile(planPath(job, job.StepId)+".json", bytes.NewReader(planJson)); err != nil {
+		return fmt.Errorf("failed to upload plan JSON: %w", err)
+	}
+
+	job.PlanSummary = terraform.SummarizePlan(plan)
+	summaryJson, err := json.Marshal(job.PlanSummary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan summary: %w", err)
+	}
+	// Path: organization/{orgId}/workspace/{workspaceId}/job/{jobId}/step/{stepId}/terraformLibrary.tfplan.summary.json
+	if err := p.Storage.UploadFile(planPath(job, job.StepId)+".summary.json", bytes.NewReader(summaryJson)); err != nil {
+		return fmt.Errorf("failed to upload plan summary: %w", err)
+	}
+	log.Printf("Plan summary for job %s: %d to add, %d to change, %d to destroy, %d to replace",
+		job.JobId, job.PlanSummary.Add, job.PlanSummary.Change, job.PlanSummary.Destroy, job.PlanSummary.Replace)
+	return nil
+}
+
+// downloadPlan fetches the plan saved by the job's plan step into the working
+// directory and returns its path
+func (p *JobProcessor) downloadPlan(job *model.TerraformJob, workingDir string) (string, error) {
+	remotePath := planPath(job, job.PlanStepId)
+	rc, err := p.Storage.DownloadFile(remotePath)
+	if err != nil {
+		return "", fmt.Errorf("plan from step %s not found: %w", job.PlanStepId, err)
+	}
+	if rc == nil {
+		return "", fmt.Errorf("plan from step %s not found at %s", job.PlanStepId, remotePath)
+	}
+	defer rc.Close()
+
+	localPath := filepath.Join(workingDir, terraform.PlanFileName)
+	f, err := os.Create(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, rc); err != nil {
+		return "", fmt.Errorf("failed to download plan from step %s: %w", job.PlanStepId, err)
+	}
+
+	log.Printf("Downloaded plan from step %s to %s", job.PlanStepId, localPath)
+	return localPath, nil
+}
+
+func (p *JobProcessor) uploadStateAndOutput(ctx context.Context, job *model.TerraformJob, workingDir, execPath string, env map[string]string) {
 	// Paths based on typical Terrakube Storage structure (need verification of exact paths)
 	// Plan: organization/%s/workspace/%s/job/%s/step/%s/terraformLibrary.tfplan
 	// State: organization/%s/workspace/%s/state/terraform.tfstate
@@ -30,31 +117,29 @@ func (p *JobProcessor) uploadStateAndOutput(job *model.TerraformJob, workingDir
 	}
 
 	// Upload Plan if exists (terraformPlan)
-	planPath := filepath.Join(workingDir, "terraform.tfplan")
-	if _, err := os.Stat(planPath); err == nil {
-		f, err := os.Open(planPath)
+	localPlanPath := filepath.Join(workingDir, terraform.PlanFileName)
+	if _, err := os.Stat(localPlanPath); err == nil && job.Type == "terraformPlan" {
+		f, err := os.Open(localPlanPath)
 		if err == nil {
 			defer f.Close()
 			// Path: organization/{orgId}/workspace/{workspaceId}/job/{jobId}/step/{stepId}/terraformLibrary.tfplan
-			remotePath := fmt.Sprintf("organization/%s/workspace/%s/job/%s/step/%s/terraformLibrary.tfplan", job.OrganizationId, job.WorkspaceId, job.JobId, job.StepId)
-			if err := p.Storage.UploadFile(remotePath, f); err != nil {
+			if err := p.Storage.UploadFile(planPath(job, job.StepId), f); err != nil {
 				log.Printf("Failed to upload plan: %v", err)
+			} else if err := p.Storage.UploadFile(latestPlanStepPath(job), strings.NewReader(job.StepId)); err != nil {
+				log.Printf("Failed to record the latest plan step: %v", err)
 			}
 		}
 	}
 
 	// Generate and Upload Output JSON (only for Apply)
 	if job.Type == "terraformApply" {
-		// Re-instantiate executor just for Output
-		execPath, err := p.VersionManager.Install(job.TerraformVersion)
+		// Separate executor without a streamer to keep the output JSON out of the logs
+		tfExecutor := terraform.NewExecutor(job, workingDir, nil, execPath, env, p.Config.CancelGracePeriod)
+		outputJson, err := tfExecutor.Output(ctx)
 		if err == nil {
-			tfExecutor := terraform.NewExecutor(job, workingDir, nil, execPath)
-			outputJson, err := tfExecutor.Output()
-			if err == nil {
-				job.TerraformOutput = outputJson
-			} else {
-				log.Printf("Failed to get terraform output: %v", err)
-			}
+			job.TerraformOutput = outputJson
+		} else {
+			log.Printf("Failed to get terraform output: %v", err)
 		}
 	}
 }
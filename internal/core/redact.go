@@ -0,0 +1,42 @@
+package core
+
+import (
+	"os"
+	"regexp"
+
+	"github.com/ilkerispir/terrakube-executor/internal/logs"
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+// sensitiveName matches variable names whose values are treated as secrets
+var sensitiveName = regexp.MustCompile(`(?i)(secret|token|passw(or)?d|private|credential|api_?key|access_?key|_key$)`)
+
+// credentialEnvVars lists the executor settings holding cloud and infrastructure credentials
+var credentialEnvVars = []string{
+	"TERRAKUBE_INTERNAL_SECRET", "InternalSecret",
+	"AWS_SECRET_ACCESS_KEY", "AwsTerraformStateSecretKey", "AWS_SESSION_TOKEN",
+	"AZURE_STORAGE_ACCOUNT_KEY", "AZURE_CLIENT_SECRET",
+	"GCP_SERVICE_ACCOUNT_KEY",
+	"REDIS_PASSWORD",
+}
+
+// newRedactor collects every secret of the job that must never reach the logs
+func (p *JobProcessor) newRedactor(job *model.TerraformJob, token string) *logs.Redactor {
+	redactor := logs.NewRedactor(job.AccessToken, token, p.Config.InternalSecret, p.Config.StorageAccountKey)
+
+	for _, name := range credentialEnvVars {
+		redactor.Add(os.Getenv(name))
+	}
+	for k, v := range job.EnvironmentVariables {
+		if sensitiveName.MatchString(k) {
+			redactor.Add(v)
+		}
+	}
+	for k, v := range job.Variables {
+		if v.Sensitive || sensitiveName.MatchString(k) {
+			redactor.Add(v.Value)
+		}
+	}
+
+	return redactor
+}
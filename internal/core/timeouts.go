@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ilkerispir/terrakube-executor/internal/config"
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+// TimeoutError is the cancellation cause used when a job or one of its phases
+// runs longer than allowed
+type TimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Phase, e.Timeout)
+}
+
+// jobTimeouts holds the effective timeouts of a job, zero meaning no timeout
+type jobTimeouts struct {
+	Job       time.Duration
+	Clone     time.Duration
+	Install   time.Duration
+	Init      time.Duration
+	Execution time.Duration
+	Scripts   time.Duration
+}
+
+// resolveTimeouts starts from the executor defaults and applies the overrides
+// from the job payload
+func resolveTimeouts(cfg *config.Config, job *model.TerraformJob) (jobTimeouts, error) {
+	t := jobTimeouts{
+		Job:       cfg.JobTimeout,
+		Clone:     cfg.CloneTimeout,
+		Install:   cfg.InstallTimeout,
+		Init:      cfg.InitTimeout,
+		Execution: cfg.ExecutionTimeout,
+		Scripts:   cfg.ScriptTimeout,
+	}
+	if job.Timeouts == nil {
+		return t, nil
+	}
+
+	overrides := []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"job", job.Timeouts.Job, &t.Job},
+		{"clone", job.Timeouts.Clone, &t.Clone},
+		{"install", job.Timeouts.Install, &t.Install},
+		{"init", job.Timeouts.Init, &t.Init},
+		{"execution", job.Timeouts.Execution, &t.Execution},
+		{"scripts", job.Timeouts.Scripts, &t.Scripts},
+	}
+	for _, o := range overrides {
+		if o.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(o.value)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s timeout %q: %w", o.name, o.value, err)
+		}
+		*o.field = d
+	}
+	return t, nil
+}
+
+// withJobTimeout bounds ctx by the job timeout, if any
+func withJobTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, timeout, &TimeoutError{Phase: "job", Timeout: timeout})
+}
+
+// runPhase runs fn with its own timeout and, when the phase or the whole job
+// timed out, makes the timeout the reason of the returned error
+func runPhase(ctx context.Context, phase string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	phaseCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		phaseCtx, cancel = context.WithTimeoutCause(ctx, timeout, &TimeoutError{Phase: phase, Timeout: timeout})
+		defer cancel()
+	}
+
+	err := fn(phaseCtx)
+	if err == nil {
+		return nil
+	}
+
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return err
+	}
+	if errors.As(context.Cause(phaseCtx), &timeoutErr) {
+		return fmt.Errorf("%w: %v", timeoutErr, err)
+	}
+	return err
+}
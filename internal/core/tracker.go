@@ -0,0 +1,239 @@
+package core
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ilkerispir/terrakube-executor/internal/logs"
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+// ErrJobActive is returned by Queued when a job with the same id is already queued or running
+var ErrJobActive = errors.New("job is already queued or running")
+
+// Job states reported by the JobTracker
+const (
+	StateQueued     = "queued"
+	StateCloning    = "cloning"
+	StateInit       = "init"
+	StatePlanning   = "planning"
+	StateApplying   = "applying"
+	StateDestroying = "destroying"
+	StateRunning    = "running"
+	StateUploading  = "uploading"
+	StateDone       = "done"
+)
+
+// Results of finished jobs
+const (
+	ResultCompleted = "completed"
+	ResultFailed    = "failed"
+	ResultCancelled = "cancelled"
+)
+
+// PhaseRecord is the time a job spent in one state
+type PhaseRecord struct {
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// JobRecord describes a queued, running or recently finished job
+type JobRecord struct {
+	JobId          string        `json:"jobId"`
+	StepId         string        `json:"stepId"`
+	OrganizationId string        `json:"organizationId"`
+	WorkspaceId    string        `json:"workspaceId"`
+	Type           string        `json:"type"`
+	State          string        `json:"state"`
+	Result         string        `json:"result,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	QueuedAt       time.Time     `json:"queuedAt"`
+	FinishedAt     *time.Time    `json:"finishedAt,omitempty"`
+	Phases         []PhaseRecord `json:"phases"`
+
+	// output holds the redacted logs of the job once it started
+	output *logs.LogBuffer
+}
+
+// JobTracker records the state of the jobs of the executor. Finished jobs are
+// kept in a bounded history, the oldest being forgotten first.
+type JobTracker struct {
+	mu       sync.Mutex
+	jobs     map[string]*JobRecord
+	finished []string
+	history  int
+}
+
+func NewJobTracker(history int) *JobTracker {
+	if history < 0 {
+		history = 0
+	}
+	return &JobTracker{
+		jobs:    make(map[string]*JobRecord),
+		history: history,
+	}
+}
+
+// Queued records a job waiting for a worker, returning ErrJobActive if a job
+// with the same id is already queued or running
+func (t *JobTracker) Queued(job *model.TerraformJob) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if r, ok := t.jobs[job.JobId]; ok && r.State != StateDone {
+		return ErrJobActive
+	}
+	t.record(job, StateQueued)
+	return nil
+}
+
+// SetState moves a job to a new state, recording the job if it is not tracked yet
+func (t *JobTracker) SetState(job *model.TerraformJob, state string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.jobs[job.JobId]
+	if !ok || r.State == StateDone {
+		t.record(job, state)
+		return
+	}
+	if r.State == state {
+		return
+	}
+
+	now := time.Now()
+	t.closePhase(r, now)
+	r.State = state
+	r.Phases = append(r.Phases, PhaseRecord{State: state, StartedAt: now})
+}
+
+// Finish records the result of a job and moves it to the history
+func (t *JobTracker) Finish(job *model.TerraformJob, result string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.jobs[job.JobId]
+	if !ok || r.State == StateDone {
+		r = t.record(job, StateDone)
+	}
+
+	now := time.Now()
+	t.closePhase(r, now)
+	r.State = StateDone
+	r.Result = result
+	r.FinishedAt = &now
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	t.finished = append(t.finished, job.JobId)
+	for len(t.finished) > t.history {
+		t.forget(t.finished[0])
+		t.finished = t.finished[1:]
+	}
+}
+
+// SetLogs attaches the log buffer of a running job
+func (t *JobTracker) SetLogs(job *model.TerraformJob, buffer *logs.LogBuffer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.jobs[job.JobId]
+	if !ok || r.State == StateDone {
+		r = t.record(job, StateQueued)
+	}
+	r.output = buffer
+}
+
+// Logs returns the log buffer of a job and the step it belongs to, the buffer
+// is nil while the job did not start. It returns false if the job is unknown.
+func (t *JobTracker) Logs(jobId string) (*logs.LogBuffer, string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.jobs[jobId]
+	if !ok {
+		return nil, "", false
+	}
+	return r.output, r.StepId, true
+}
+
+// Get returns a copy of the record of a job
+func (t *JobTracker) Get(jobId string) (JobRecord, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.jobs[jobId]
+	if !ok {
+		return JobRecord{}, false
+	}
+	return r.copy(), true
+}
+
+// List returns a copy of every record, most recently queued first
+func (t *JobTracker) List() []JobRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	records := make([]JobRecord, 0, len(t.jobs))
+	for _, r := range t.jobs {
+		records = append(records, r.copy())
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].QueuedAt.After(records[j].QueuedAt)
+	})
+	return records
+}
+
+// record starts a new record for a job, replacing a finished one with the same id
+func (t *JobTracker) record(job *model.TerraformJob, state string) *JobRecord {
+	if old, ok := t.jobs[job.JobId]; ok && old.State == StateDone {
+		t.removeFinished(job.JobId)
+	}
+
+	now := time.Now()
+	r := &JobRecord{
+		JobId:          job.JobId,
+		StepId:         job.StepId,
+		OrganizationId: job.OrganizationId,
+		WorkspaceId:    job.WorkspaceId,
+		Type:           job.Type,
+		State:          state,
+		QueuedAt:       now,
+	}
+	if state != StateDone {
+		r.Phases = []PhaseRecord{{State: state, StartedAt: now}}
+	}
+	t.jobs[job.JobId] = r
+	return r
+}
+
+func (t *JobTracker) closePhase(r *JobRecord, now time.Time) {
+	if n := len(r.Phases); n > 0 && r.Phases[n-1].FinishedAt == nil {
+		r.Phases[n-1].FinishedAt = &now
+	}
+}
+
+func (t *JobTracker) forget(jobId string) {
+	if r, ok := t.jobs[jobId]; ok && r.State == StateDone {
+		delete(t.jobs, jobId)
+	}
+}
+
+func (t *JobTracker) removeFinished(jobId string) {
+	for i, id := range t.finished {
+		if id == jobId {
+			t.finished = append(t.finished[:i:i], t.finished[i+1:]...)
+			return
+		}
+	}
+}
+
+func (r *JobRecord) copy() JobRecord {
+	c := *r
+	c.Phases = append([]PhaseRecord(nil), r.Phases...)
+	return c
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+func TestJobTracker(t *testing.T) {
+	job := func(id string) *model.TerraformJob {
+		return &model.TerraformJob{JobId: id, StepId: "step-" + id, Type: "terraformDestroy"}
+	}
+
+	tests := []struct {
+		name       string
+		history    int
+		run        func(tr *JobTracker)
+		wantStates map[string]string
+	}{
+		{
+			name:    "queued rejects a running job",
+			history: 10,
+			run: func(tr *JobTracker) {
+				tr.Queued(job("1"))
+				tr.SetState(job("1"), StateDestroying)
+				if err := tr.Queued(job("1")); !errors.Is(err, ErrJobActive) {
+					t.Errorf("Queued() of a running job = %v, want %v", err, ErrJobActive)
+				}
+			},
+			wantStates: map[string]string{"1": StateDestroying},
+		},
+		{
+			name:    "queued replaces a finished job",
+			history: 10,
+			run: func(tr *JobTracker) {
+				tr.Queued(job("1"))
+				tr.Finish(job("1"), ResultCompleted, nil)
+				if err := tr.Queued(job("1")); err != nil {
+					t.Errorf("Queued() of a finished job = %v", err)
+				}
+			},
+			wantStates: map[string]string{"1": StateQueued},
+		},
+		{
+			name:    "oldest finished jobs are forgotten",
+			history: 2,
+			run: func(tr *JobTracker) {
+				for _, id := range []string{"1", "2", "3"} {
+					tr.Queued(job(id))
+					tr.Finish(job(id), ResultFailed, errors.New("failed"))
+				}
+				tr.Queued(job("4"))
+			},
+			wantStates: map[string]string{"2": StateDone, "3": StateDone, "4": StateQueued},
+		},
+		{
+			name:    "running jobs are not forgotten",
+			history: 0,
+			run: func(tr *JobTracker) {
+				tr.Queued(job("1"))
+				tr.SetState(job("1"), StateInit)
+				tr.Queued(job("2"))
+				tr.Finish(job("2"), ResultCancelled, nil)
+			},
+			wantStates: map[string]string{"1": StateInit},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewJobTracker(tt.history)
+			tt.run(tr)
+
+			records := tr.List()
+			if len(records) != len(tt.wantStates) {
+				t.Errorf("List() returned %d records, want %d", len(records), len(tt.wantStates))
+			}
+			for _, r := range records {
+				if want, ok := tt.wantStates[r.JobId]; !ok || r.State != want {
+					t.Errorf("job %s is %q, want %q", r.JobId, r.State, want)
+				}
+			}
+		})
+	}
+}
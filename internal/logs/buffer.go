@@ -0,0 +1,153 @@
+package logs
+
+import (
+	"context"
+	"sync"
+)
+
+// LogBuffer keeps the most recent output of a job in a fixed size ring so that
+// it can be replayed and followed by readers. Offsets count every byte ever
+// written; bytes older than the capacity are dropped. The ring grows with the
+// output up to its capacity.
+type LogBuffer struct {
+	mu       sync.Mutex
+	data     []byte
+	capacity int64
+	end      int64
+	closed   bool
+	notify   chan struct{}
+}
+
+func NewLogBuffer(capacity int) *LogBuffer {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LogBuffer{
+		capacity: int64(capacity),
+		notify:   make(chan struct{}),
+	}
+}
+
+func (b *LogBuffer) Write(p []byte) (n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return len(p), nil
+	}
+
+	// Only the tail of a write larger than the buffer can be kept
+	written := p
+	size := b.capacity
+	if int64(len(p)) > size {
+		b.end += int64(len(p)) - size
+		p = p[int64(len(p))-size:]
+	}
+	if grown := min(size, b.end+int64(len(p))); grown > int64(len(b.data)) {
+		b.data = append(b.data, make([]byte, grown-int64(len(b.data)))...)
+	}
+	for len(p) > 0 {
+		i := int(b.end % size)
+		c := copy(b.data[i:], p)
+		p = p[c:]
+		b.end += int64(c)
+	}
+
+	b.wake()
+	return len(written), nil
+}
+
+// Close marks the output as complete, waking up readers waiting for more
+func (b *LogBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		b.wake()
+	}
+	return nil
+}
+
+// Read returns the output from offset, or from the oldest byte still buffered
+// if offset was dropped or is past the output, along with the offset following
+// it and whether the output is complete
+func (b *LogBuffer) Read(offset int64) (data []byte, next int64, closed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if offset > b.end {
+		offset = 0
+	}
+	return b.read(offset), b.end, b.closed
+}
+
+// Shrink lowers the capacity of the buffer, keeping the most recent output, so
+// that the output of a finished job holds less memory. Offsets are unchanged.
+func (b *LogBuffer) Shrink(capacity int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	size := int64(max(capacity, 1))
+	if size >= b.capacity {
+		return
+	}
+
+	start := max(b.end-size, 0)
+	kept := b.read(start)
+	data := make([]byte, len(kept))
+	n := copy(data[start%size:], kept)
+	copy(data, kept[n:])
+
+	b.data = data
+	b.capacity = size
+}
+
+// read returns the output from offset, or from the oldest byte still buffered
+// if offset was dropped, b.mu must be held
+func (b *LogBuffer) read(offset int64) []byte {
+	size := b.capacity
+	if start := b.end - size; offset < start {
+		offset = start
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= b.end {
+		return nil
+	}
+
+	data := make([]byte, 0, b.end-offset)
+	for pos := offset; pos < b.end; {
+		i := pos % size
+		chunk := b.data[i:min(size, i+b.end-pos)]
+		data = append(data, chunk...)
+		pos += int64(len(chunk))
+	}
+	return data
+}
+
+// Wait blocks until output past offset is written, the buffer is closed or ctx
+// is done, returning false in the latter case
+func (b *LogBuffer) Wait(ctx context.Context, offset int64) bool {
+	b.mu.Lock()
+	if b.end > offset || b.closed {
+		b.mu.Unlock()
+		return true
+	}
+	notify := b.notify
+	b.mu.Unlock()
+
+	select {
+	case <-notify:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// wake notifies the waiting readers, b.mu must be held
+func (b *LogBuffer) wake() {
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
@@ -0,0 +1,200 @@
+package logs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLogBufferRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		writes   []string
+		offset   int64
+		want     string
+		wantNext int64
+	}{
+		{
+			name:     "empty",
+			capacity: 8,
+			want:     "",
+			wantNext: 0,
+		},
+		{
+			name:     "from start",
+			capacity: 8,
+			writes:   []string{"abc", "de"},
+			want:     "abcde",
+			wantNext: 5,
+		},
+		{
+			name:     "from offset",
+			capacity: 8,
+			writes:   []string{"abc", "de"},
+			offset:   3,
+			want:     "de",
+			wantNext: 5,
+		},
+		{
+			name:     "wrapped",
+			capacity: 4,
+			writes:   []string{"abc", "def"},
+			want:     "cdef",
+			wantNext: 6,
+		},
+		{
+			name:     "offset dropped",
+			capacity: 4,
+			writes:   []string{"abc", "def"},
+			offset:   1,
+			want:     "cdef",
+			wantNext: 6,
+		},
+		{
+			name:     "write larger than capacity",
+			capacity: 4,
+			writes:   []string{"ab", "cdefghij"},
+			want:     "ghij",
+			wantNext: 10,
+		},
+		{
+			name:     "offset past the end",
+			capacity: 8,
+			writes:   []string{"abc"},
+			offset:   42,
+			want:     "abc",
+			wantNext: 3,
+		},
+		{
+			name:     "at the end",
+			capacity: 8,
+			writes:   []string{"abc"},
+			offset:   3,
+			want:     "",
+			wantNext: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewLogBuffer(tt.capacity)
+			for _, w := range tt.writes {
+				if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			if len(b.data) > tt.capacity {
+				t.Errorf("buffer grew to %d bytes, over its capacity of %d", len(b.data), tt.capacity)
+			}
+
+			data, next, closed := b.Read(tt.offset)
+			if string(data) != tt.want || next != tt.wantNext || closed {
+				t.Errorf("Read(%d) = %q, %d, %v, want %q, %d, false", tt.offset, data, next, closed, tt.want, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestLogBufferWait(t *testing.T) {
+	b := NewLogBuffer(8)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	go func() {
+		b.Write([]byte("abc"))
+		b.Close()
+	}()
+	if !b.Wait(ctx, 0) {
+		t.Fatal("Wait() timed out before the write")
+	}
+	if !b.Wait(ctx, 3) {
+		t.Fatal("Wait() timed out before the close")
+	}
+	if _, _, closed := b.Read(3); !closed {
+		t.Error("Read() after Close() reports the output as not complete")
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if NewLogBuffer(8).Wait(cancelled, 0) {
+		t.Error("Wait() returned true on a cancelled context")
+	}
+}
+
+func TestLogBufferShrink(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		writes   []string
+		shrink   int
+		offset   int64
+		want     string
+	}{
+		{
+			name:     "short output is kept",
+			capacity: 8,
+			writes:   []string{"abc"},
+			shrink:   4,
+			want:     "abc",
+		},
+		{
+			name:     "tail is kept",
+			capacity: 8,
+			writes:   []string{"abcdef"},
+			shrink:   4,
+			want:     "cdef",
+		},
+		{
+			name:     "wrapped output",
+			capacity: 4,
+			writes:   []string{"abc", "def", "g"},
+			shrink:   3,
+			want:     "efg",
+		},
+		{
+			name:     "offsets are unchanged",
+			capacity: 8,
+			writes:   []string{"abcdefghij"},
+			shrink:   5,
+			offset:   7,
+			want:     "hij",
+		},
+		{
+			name:     "larger capacity is ignored",
+			capacity: 4,
+			writes:   []string{"abcdef"},
+			shrink:   16,
+			want:     "cdef",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewLogBuffer(tt.capacity)
+			for _, w := range tt.writes {
+				b.Write([]byte(w))
+			}
+			b.Close()
+			end := b.end
+
+			b.Shrink(tt.shrink)
+			if len(b.data) > tt.shrink {
+				t.Errorf("buffer holds %d bytes after Shrink(%d)", len(b.data), tt.shrink)
+			}
+			data, next, closed := b.Read(tt.offset)
+			if string(data) != tt.want || next != end || !closed {
+				t.Errorf("Read(%d) = %q, %d, %v, want %q, %d, true", tt.offset, data, next, closed, tt.want, end)
+			}
+		})
+	}
+
+	// Writes after Shrink keep the ring consistent
+	b := NewLogBuffer(8)
+	b.Write([]byte("abcdefghij"))
+	b.Shrink(4)
+	b.Write([]byte("kl"))
+	if data, next, _ := b.Read(0); string(data) != "ijkl" || next != 12 {
+		t.Errorf("Read(0) after Shrink and Write = %q, %d, want \"ijkl\", 12", data, next)
+	}
+}
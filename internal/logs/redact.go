@@ -0,0 +1,146 @@
+package logs
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// RedactedValue replaces every secret found in the logs
+const RedactedValue = "***"
+
+// minSecretLength avoids masking every occurrence of trivially short values
+const minSecretLength = 4
+
+// Redactor masks a set of secret values in text
+type Redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{}
+	r.Add(secrets...)
+	return r
+}
+
+// Add registers secrets to mask. Each line of a multi-line secret, such as a
+// private key, is also masked on its own.
+func (r *Redactor) Add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, secret := range secrets {
+		r.add(secret)
+		if strings.Contains(secret, "\n") {
+			for _, line := range strings.Split(secret, "\n") {
+				r.add(strings.TrimSpace(line))
+			}
+		}
+	}
+
+	// Replace longer secrets first so that a secret containing another one is fully masked
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+func (r *Redactor) add(secret string) {
+	if len(secret) < minSecretLength {
+		return
+	}
+	for _, s := range r.secrets {
+		if s == secret {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, secret)
+}
+
+// Redact returns s with every secret masked
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, RedactedValue)
+	}
+	return s
+}
+
+// longest returns the length of the longest secret
+func (r *Redactor) longest() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.secrets) == 0 {
+		return 0
+	}
+	return len(r.secrets[0])
+}
+
+// RedactingStreamer masks secrets before passing logs to another LogStreamer.
+// A secret may be split across writes, so the last bytes of each write are
+// held back until more output arrives or the streamer is flushed.
+type RedactingStreamer struct {
+	mu       sync.Mutex
+	streamer LogStreamer
+	redactor *Redactor
+	pending  string
+}
+
+func NewRedactingStreamer(streamer LogStreamer, redactor *Redactor) *RedactingStreamer {
+	return &RedactingStreamer{
+		streamer: streamer,
+		redactor: redactor,
+	}
+}
+
+func (r *RedactingStreamer) Write(p []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	text := r.redactor.Redact(r.pending + string(p))
+
+	// Any secret starting before the held back tail is complete and already masked
+	keep := r.redactor.longest() - 1
+	if keep < 0 {
+		keep = 0
+	}
+	if keep > len(text) {
+		keep = len(text)
+	}
+	cut := len(text) - keep
+	// Do not split a multi-byte character
+	for cut > 0 && cut < len(text) && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+
+	r.pending = text[cut:]
+	if out := text[:cut]; out != "" {
+		if _, err := r.streamer.Write([]byte(out)); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes the held back output
+func (r *RedactingStreamer) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending == "" {
+		return nil
+	}
+	out := r.redactor.Redact(r.pending)
+	r.pending = ""
+	_, err := r.streamer.Write([]byte(out))
+	return err
+}
+
+func (r *RedactingStreamer) Close() error {
+	r.Flush()
+	return r.streamer.Close()
+}
@@ -0,0 +1,123 @@
+package logs
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRedactorRedact(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []string
+		in      string
+		want    string
+	}{
+		{
+			name: "no secrets",
+			in:   "token=abcdef",
+			want: "token=abcdef",
+		},
+		{
+			name:    "every occurrence",
+			secrets: []string{"abcdef"},
+			in:      "abcdef and abcdef",
+			want:    "*** and ***",
+		},
+		{
+			name:    "short values are not masked",
+			secrets: []string{"abc"},
+			in:      "abc",
+			want:    "abc",
+		},
+		{
+			name:    "longer secret containing another one",
+			secrets: []string{"pass", "password123"},
+			in:      "password123 pass",
+			want:    "*** ***",
+		},
+		{
+			name:    "lines of a multi-line secret",
+			secrets: []string{"-----BEGIN KEY-----\nMIIEowIBAAKCAQEA\n-----END KEY-----"},
+			in:      "key: MIIEowIBAAKCAQEA",
+			want:    "key: ***",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewRedactor(tt.secrets...).Redact(tt.in); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// bufferStreamer collects the output, recording whether a write split a character
+type bufferStreamer struct {
+	bytes.Buffer
+	splitRune bool
+}
+
+func (b *bufferStreamer) Write(p []byte) (int, error) {
+	if !utf8.Valid(p) {
+		b.splitRune = true
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *bufferStreamer) Close() error { return nil }
+
+func TestRedactingStreamer(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []string
+		writes  []string
+		want    string
+	}{
+		{
+			name:    "secret in one write",
+			secrets: []string{"s3cr3t-value"},
+			writes:  []string{"password is s3cr3t-value\n"},
+			want:    "password is ***\n",
+		},
+		{
+			name:    "secret split across writes",
+			secrets: []string{"s3cr3t-value"},
+			writes:  []string{"password is s3c", "r3t-va", "lue\n"},
+			want:    "password is ***\n",
+		},
+		{
+			name:    "multi-byte characters are kept whole",
+			secrets: []string{"s3cr3t-value"},
+			writes:  []string{"héllo wörld ", "ünïcode"},
+			want:    "héllo wörld ünïcode",
+		},
+		{
+			name:   "no secrets",
+			writes: []string{"a", "b"},
+			want:   "ab",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bufferStreamer{}
+			streamer := NewRedactingStreamer(out, NewRedactor(tt.secrets...))
+			for _, w := range tt.writes {
+				if n, err := streamer.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			if err := streamer.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+			if out.splitRune {
+				t.Error("a write split a multi-byte character")
+			}
+		})
+	}
+}
@@ -1,15 +1,51 @@
 package batch
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/ilkerispir/terrakube-executor/internal/core"
 	"github.com/ilkerispir/terrakube-executor/internal/model"
 )
 
-func AdjustAndExecute(job *model.TerraformJob, processor *core.JobProcessor) {
+// AdjustAndExecute runs a single job. When ctx is cancelled the job gets the
+// drain timeout to finish before it is cancelled and reported as failed.
+func AdjustAndExecute(ctx context.Context, job *model.TerraformJob, processor *core.JobProcessor) {
 	log.Printf("Starting Batch Execution for Job %s", job.JobId)
-	if err := processor.ProcessJob(job); err != nil {
+
+	jobCtx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-jobCtx.Done():
+			return
+		}
+		log.Printf("Shutdown signal received, waiting up to %s for job %s", processor.Config.DrainTimeout, job.JobId)
+		select {
+		case <-time.After(processor.Config.DrainTimeout):
+			cancel(core.ErrShuttingDown)
+		case <-jobCtx.Done():
+		}
+	}()
+
+	if cache := processor.PluginCache; cache != nil {
+		if err := cache.Restore(); err != nil {
+			log.Printf("Failed to restore plugin cache: %v", err)
+		}
+	}
+
+	err := processor.ProcessJob(jobCtx, job)
+
+	if cache := processor.PluginCache; cache != nil {
+		if err := cache.Persist(); err != nil {
+			log.Printf("Failed to persist plugin cache: %v", err)
+		}
+	}
+
+	if err != nil {
 		log.Fatalf("Job execution failed: %v", err)
 	}
 	log.Println("Batch execution finished")
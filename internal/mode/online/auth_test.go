@@ -0,0 +1,60 @@
+package online
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ilkerispir/terrakube-executor/internal/config"
+)
+
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rawKey := []byte("0123456789abcdef0123456789abcdef")
+	secret := base64.URLEncoding.EncodeToString(rawKey)
+	valid, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "TerrakubeInternal",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(rawKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authEnabled   bool
+		authorization string
+		want          int
+	}{
+		{"valid token", true, "Bearer " + valid, http.StatusOK},
+		{"missing header", true, "", http.StatusUnauthorized},
+		{"basic scheme", true, "Basic " + valid, http.StatusUnauthorized},
+		{"lowercase scheme", true, "bearer " + valid, http.StatusUnauthorized},
+		{"empty bearer", true, "Bearer ", http.StatusUnauthorized},
+		{"garbage", true, "Bearer garbage", http.StatusUnauthorized},
+		{"auth disabled", false, "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/api/v1/jobs", authenticate(&config.Config{AuthEnabled: tt.authEnabled, InternalSecret: secret}), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
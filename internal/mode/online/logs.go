@@ -0,0 +1,55 @@
+package online
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/ilkerispir/terrakube-executor/internal/logs"
+)
+
+// newlines translates carriage returns, which Server-Sent Events cannot carry
+// in data, into line feeds
+var newlines = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// streamLogs sends the output of a job step as Server-Sent Events, replaying it
+// from the start, or from the Last-Event-ID sent by a reconnecting client, and
+// then following it until the step is done or ctx is cancelled. Event ids are
+// <stepId>:<offset>, an id of another step of the job replays from the start.
+func streamLogs(ctx context.Context, c *gin.Context, output *logs.LogBuffer, stepId string) {
+	var offset int64
+	if step, id, ok := strings.Cut(c.GetHeader("Last-Event-ID"), ":"); ok && step == stepId {
+		if n, err := strconv.ParseInt(id, 10, 64); err == nil && n > 0 {
+			offset = n
+		}
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(c.Request.Context(), cancel)
+	defer stop()
+
+	c.Stream(func(w io.Writer) bool {
+		data, next, closed := output.Read(offset)
+		offset = next
+		if len(data) > 0 {
+			c.Render(-1, sse.Event{
+				Id:    stepId + ":" + strconv.FormatInt(next, 10),
+				Event: "log",
+				Data:  newlines.Replace(string(data)),
+			})
+			return true
+		}
+		if closed {
+			c.SSEvent("end", "")
+			return false
+		}
+		return output.Wait(ctx, offset)
+	})
+}
@@ -0,0 +1,239 @@
+package online
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+// ErrQueueFull is returned by Submit when the backlog has reached its capacity
+var ErrQueueFull = errors.New("job queue is full")
+
+// ErrQueueClosed is returned by Submit once the queue stopped accepting jobs
+var ErrQueueClosed = errors.New("job queue is closed")
+
+// ErrInvalidJob is returned by Submit for jobs without a job or workspace id
+var ErrInvalidJob = errors.New("jobId and workspaceId are required")
+
+// JobQueue runs jobs on a fixed number of workers with a bounded backlog.
+// Jobs for the same workspace are executed one at a time in FIFO order.
+type JobQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queued   func(job *model.TerraformJob) error
+	handler  func(job *model.TerraformJob) func()
+	capacity int
+	pending  int
+	closed   bool
+	inflight sync.WaitGroup
+
+	// workspaces maps a workspace id to its jobs waiting to run
+	workspaces map[string][]*model.TerraformJob
+	// busy contains workspaces that currently have a running job
+	busy map[string]bool
+	// ready lists workspaces with pending jobs and no running job, in arrival order
+	ready []string
+}
+
+// NewJobQueue starts the workers of a queue. queued is called while the queue
+// is locked before a job is accepted, and handler as soon as a job is taken out
+// of it, so that the job can be recorded without a window where it is neither
+// queued nor running. The job is rejected with the error returned by queued,
+// which is how duplicates are refused. Neither must block, the function
+// returned by handler runs the job.
+func NewJobQueue(workers, capacity int, queued func(job *model.TerraformJob) error, handler func(job *model.TerraformJob) func()) *JobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	q := &JobQueue{
+		queued:     queued,
+		handler:    handler,
+		capacity:   capacity,
+		workspaces: make(map[string][]*model.TerraformJob),
+		busy:       make(map[string]bool),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+
+	log.Printf("Job queue started with %d workers and capacity %d", workers, capacity)
+	return q
+}
+
+// Submit enqueues a job, returning ErrInvalidJob if it has no job or workspace
+// id, ErrQueueFull if the backlog is at capacity and the error of the queued
+// callback if it rejected the job
+func (q *JobQueue) Submit(job *model.TerraformJob) error {
+	if job.JobId == "" || job.WorkspaceId == "" {
+		return ErrInvalidJob
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.pending >= q.capacity {
+		return ErrQueueFull
+	}
+	if err := q.queued(job); err != nil {
+		return err
+	}
+
+	ws := job.WorkspaceId
+	if len(q.workspaces[ws]) == 0 && !q.busy[ws] {
+		q.ready = append(q.ready, ws)
+	}
+	q.workspaces[ws] = append(q.workspaces[ws], job)
+	q.pending++
+
+	q.cond.Signal()
+	return nil
+}
+
+// Pending returns the number of jobs waiting for a worker
+func (q *JobQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// Remove takes a job that has not started yet out of the queue, returning nil
+// if no pending job has the given id
+func (q *JobQueue) Remove(jobId string) *model.TerraformJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for ws, jobs := range q.workspaces {
+		for i, job := range jobs {
+			if job.JobId != jobId {
+				continue
+			}
+			jobs = append(jobs[:i:i], jobs[i+1:]...)
+			if len(jobs) == 0 {
+				delete(q.workspaces, ws)
+				q.removeReady(ws)
+			} else {
+				q.workspaces[ws] = jobs
+			}
+			q.pending--
+			return job
+		}
+	}
+	return nil
+}
+
+func (q *JobQueue) removeReady(ws string) {
+	for i, r := range q.ready {
+		if r == ws {
+			q.ready = append(q.ready[:i:i], q.ready[i+1:]...)
+			return
+		}
+	}
+}
+
+// Close stops accepting jobs and stops the workers once their current job is done.
+// Jobs that never started are returned so that the caller can report them.
+func (q *JobQueue) Close() []*model.TerraformJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var dropped []*model.TerraformJob
+	for _, jobs := range q.workspaces {
+		dropped = append(dropped, jobs...)
+	}
+	q.workspaces = make(map[string][]*model.TerraformJob)
+	q.ready = nil
+	q.pending = 0
+	q.closed = true
+
+	q.cond.Broadcast()
+	return dropped
+}
+
+// Wait blocks until all running jobs are done or the timeout expires,
+// returning false on timeout
+func (q *JobQueue) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		q.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (q *JobQueue) next() (string, *model.TerraformJob, func(), bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.ready) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return "", nil, nil, false
+	}
+
+	ws := q.ready[0]
+	q.ready = q.ready[1:]
+
+	jobs := q.workspaces[ws]
+	job := jobs[0]
+	if len(jobs) == 1 {
+		delete(q.workspaces, ws)
+	} else {
+		q.workspaces[ws] = jobs[1:]
+	}
+	q.pending--
+	q.busy[ws] = true
+	q.inflight.Add(1)
+
+	return ws, job, q.handler(job), true
+}
+
+func (q *JobQueue) done(ws string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.busy, ws)
+	q.inflight.Done()
+	if len(q.workspaces[ws]) > 0 {
+		q.ready = append(q.ready, ws)
+		q.cond.Signal()
+	}
+}
+
+func (q *JobQueue) worker() {
+	for {
+		ws, job, run, ok := q.next()
+		if !ok {
+			return
+		}
+		q.run(job, run)
+		q.done(ws)
+	}
+}
+
+func (q *JobQueue) run(job *model.TerraformJob, run func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v", job.JobId, r)
+		}
+	}()
+	run()
+}
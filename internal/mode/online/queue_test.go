@@ -0,0 +1,205 @@
+package online
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ilkerispir/terrakube-executor/internal/core"
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+// recorder runs the jobs of a queue, blocking each one until it is released
+type recorder struct {
+	mu      sync.Mutex
+	queued  []string
+	started chan string
+	release map[string]chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		started: make(chan string, 16),
+		release: make(map[string]chan struct{}),
+	}
+}
+
+func (r *recorder) gate(jobId string) chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.release[jobId]; !ok {
+		r.release[jobId] = make(chan struct{})
+	}
+	return r.release[jobId]
+}
+
+// onQueued rejects ids it saw before, like the job tracker does for jobs that did not finish
+func (r *recorder) onQueued(job *model.TerraformJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range r.queued {
+		if id == job.JobId {
+			return core.ErrJobActive
+		}
+	}
+	r.queued = append(r.queued, job.JobId)
+	return nil
+}
+
+func (r *recorder) handler(job *model.TerraformJob) func() {
+	return func() {
+		r.started <- job.JobId
+		<-r.gate(job.JobId)
+	}
+}
+
+func (r *recorder) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case id := <-r.started:
+		return id
+	case <-time.After(time.Second):
+		t.Fatal("no job started")
+		return ""
+	}
+}
+
+func (r *recorder) idle(t *testing.T) {
+	t.Helper()
+	select {
+	case id := <-r.started:
+		t.Fatalf("job %s started unexpectedly", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestJobQueue(t *testing.T) {
+	job := func(id, ws string) *model.TerraformJob {
+		return &model.TerraformJob{JobId: id, WorkspaceId: ws}
+	}
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, q *JobQueue, r *recorder)
+	}{
+		{
+			name: "jobs of a workspace run one at a time in order",
+			run: func(t *testing.T, q *JobQueue, r *recorder) {
+				for _, id := range []string{"1", "2", "3"} {
+					if err := q.Submit(job(id, "ws")); err != nil {
+						t.Fatal(err)
+					}
+				}
+				for _, want := range []string{"1", "2", "3"} {
+					if got := r.next(t); got != want {
+						t.Fatalf("started job %s, want %s", got, want)
+					}
+					r.idle(t)
+					close(r.gate(want))
+				}
+			},
+		},
+		{
+			name: "workspaces run concurrently",
+			run: func(t *testing.T, q *JobQueue, r *recorder) {
+				q.Submit(job("1", "a"))
+				q.Submit(job("2", "b"))
+				started := map[string]bool{r.next(t): true, r.next(t): true}
+				if !started["1"] || !started["2"] {
+					t.Fatalf("started %v, want jobs 1 and 2", started)
+				}
+				close(r.gate("1"))
+				close(r.gate("2"))
+			},
+		},
+		{
+			name: "removed jobs never run",
+			run: func(t *testing.T, q *JobQueue, r *recorder) {
+				q.Submit(job("1", "ws"))
+				q.Submit(job("2", "ws"))
+				q.Submit(job("3", "ws"))
+				if got := r.next(t); got != "1" {
+					t.Fatalf("started job %s, want 1", got)
+				}
+				if q.Remove("1") != nil {
+					t.Error("Remove() returned a running job")
+				}
+				if removed := q.Remove("2"); removed == nil || removed.JobId != "2" {
+					t.Fatalf("Remove(2) = %v", removed)
+				}
+				if q.Pending() != 1 {
+					t.Errorf("Pending() = %d, want 1", q.Pending())
+				}
+				close(r.gate("1"))
+				if got := r.next(t); got != "3" {
+					t.Fatalf("started job %s, want 3", got)
+				}
+				close(r.gate("3"))
+			},
+		},
+		{
+			name: "invalid and duplicate jobs are rejected",
+			run: func(t *testing.T, q *JobQueue, r *recorder) {
+				if err := q.Submit(job("", "ws")); !errors.Is(err, ErrInvalidJob) {
+					t.Errorf("Submit() without job id = %v, want %v", err, ErrInvalidJob)
+				}
+				if err := q.Submit(job("1", "")); !errors.Is(err, ErrInvalidJob) {
+					t.Errorf("Submit() without workspace id = %v, want %v", err, ErrInvalidJob)
+				}
+				q.Submit(job("1", "ws"))
+				r.next(t)
+				if err := q.Submit(job("1", "other")); !errors.Is(err, core.ErrJobActive) {
+					t.Errorf("Submit() of a running job = %v, want %v", err, core.ErrJobActive)
+				}
+				if q.Pending() != 0 {
+					t.Errorf("Pending() = %d, want 0", q.Pending())
+				}
+				close(r.gate("1"))
+				r.idle(t)
+			},
+		},
+		{
+			name: "full and closed queues reject jobs",
+			run: func(t *testing.T, q *JobQueue, r *recorder) {
+				q.Submit(job("1", "ws"))
+				r.next(t)
+				q.Submit(job("2", "ws"))
+				q.Submit(job("3", "ws"))
+				q.Submit(job("4", "ws"))
+				if err := q.Submit(job("5", "ws")); !errors.Is(err, ErrQueueFull) {
+					t.Errorf("Submit() over capacity = %v, want %v", err, ErrQueueFull)
+				}
+
+				dropped := q.Close()
+				if len(dropped) != 3 {
+					t.Errorf("Close() dropped %d jobs, want 3", len(dropped))
+				}
+				if err := q.Submit(job("6", "ws")); !errors.Is(err, ErrQueueClosed) {
+					t.Errorf("Submit() after Close() = %v, want %v", err, ErrQueueClosed)
+				}
+				close(r.gate("1"))
+				if !q.Wait(time.Second) {
+					t.Error("Wait() timed out")
+				}
+				r.idle(t)
+
+				// Rejected jobs are not recorded as queued
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				if len(r.queued) != 4 {
+					t.Errorf("queued %v, want jobs 1 to 4", r.queued)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRecorder()
+			q := NewJobQueue(2, 3, r.onQueued, r.handler)
+			defer q.Close()
+			tt.run(t, q, r)
+		})
+	}
+}
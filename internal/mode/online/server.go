@@ -1,35 +1,130 @@
 package online
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ilkerispir/terrakube-executor/internal/core"
 	"github.com/ilkerispir/terrakube-executor/internal/model"
 )
 
-func StartServer(port string, processor *core.JobProcessor) {
+// StartServer serves the executor API until ctx is cancelled, then drains the
+// running jobs before returning
+func StartServer(ctx context.Context, port string, processor *core.JobProcessor) {
+	var ready atomic.Bool
+	ready.Store(true)
+
+	// Jobs keep running while the HTTP server shuts down, they are stopped
+	// explicitly once the drain timeout expires
+	jobCtx := context.WithoutCancel(ctx)
+	queue := NewJobQueue(processor.Config.WorkerCount, processor.Config.QueueSize, processor.Tracker.Queued, func(job *model.TerraformJob) func() {
+		ctx, done := processor.Track(jobCtx, job.JobId)
+		return func() {
+			defer done()
+			processor.ProcessTracked(ctx, job)
+		}
+	})
+
+	if processor.Config.AuthEnabled && processor.Config.InternalSecret == "" {
+		log.Fatal("Job API authentication requires TERRAKUBE_INTERNAL_SECRET, set EXECUTOR_AUTH_ENABLED=false to run without it")
+	}
+	if !processor.Config.AuthEnabled {
+		log.Println("WARNING: job API authentication is disabled by EXECUTOR_AUTH_ENABLED=false, anyone reaching the executor can run jobs")
+	}
+	tlsCfg, err := tlsConfig(processor.Config)
+	if err != nil {
+		log.Fatalf("Failed to configure TLS: %v", err)
+	}
+
+	streamsCtx, stopStreams := context.WithCancel(context.Background())
+	defer stopStreams()
+
 	r := gin.Default()
+	api := r.Group("/api/v1", authenticate(processor.Config))
 
-	r.POST("/api/v1/terraform-rs", func(c *gin.Context) {
+	api.POST("/terraform-rs", func(c *gin.Context) {
 		bodyBytes, _ := c.GetRawData()
-		log.Printf("Received raw payload: %s", string(bodyBytes))
 
 		var job model.TerraformJob
 		if err := json.Unmarshal(bodyBytes, &job); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		// The payload holds access tokens and variables, only log what identifies the job
+		log.Printf("Received job %s (step %s, type %s) for workspace %s", job.JobId, job.StepId, job.Type, job.WorkspaceId)
+
+		if err := queue.Submit(&job); err != nil {
+			log.Printf("Rejecting job %s: %v", job.JobId, err)
+			switch {
+			case errors.Is(err, ErrInvalidJob):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, core.ErrJobActive):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, ErrQueueClosed):
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			default:
+				c.Header("Retry-After", "30")
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		// The job belongs to the worker once submitted and holds secrets, only its id is echoed
+		c.JSON(http.StatusAccepted, gin.H{"jobId": job.JobId, "status": "queued"})
+	})
+
+	api.DELETE("/terraform-rs/:jobId", func(c *gin.Context) {
+		jobId := c.Param("jobId")
 
-		// Process job asynchronously
-		// In a real implementation this should be offloaded to a worker pool
-		go func() {
-			processor.ProcessJob(&job)
-		}()
+		if job := queue.Remove(jobId); job != nil {
+			log.Printf("Cancelled queued job %s", jobId)
+			processor.Tracker.Finish(job, core.ResultCancelled, nil)
+			if err := processor.Status.SetCancelled(context.Background(), job, processor.JobToken(job), "Job cancelled before execution"); err != nil {
+				log.Printf("Failed to set cancelled status: %v", err)
+			}
+			c.JSON(http.StatusOK, gin.H{"jobId": jobId, "status": "cancelled"})
+			return
+		}
+
+		if processor.CancelJob(jobId) {
+			c.JSON(http.StatusAccepted, gin.H{"jobId": jobId, "status": "cancelling"})
+			return
+		}
+
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+	})
+
+	api.GET("/jobs", func(c *gin.Context) {
+		c.JSON(http.StatusOK, processor.Tracker.List())
+	})
+
+	api.GET("/jobs/:jobId", func(c *gin.Context) {
+		record, ok := processor.Tracker.Get(c.Param("jobId"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		c.JSON(http.StatusOK, record)
+	})
 
-		c.JSON(http.StatusAccepted, job)
+	api.GET("/jobs/:jobId/logs", func(c *gin.Context) {
+		output, stepId, ok := processor.Tracker.Logs(c.Param("jobId"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		if output == nil {
+			c.Header("Retry-After", "5")
+			c.JSON(http.StatusConflict, gin.H{"error": "job has not started yet"})
+			return
+		}
+		streamLogs(streamsCtx, c, output, stepId)
 	})
 
 	r.GET("/actuator/health", func(c *gin.Context) {
@@ -39,8 +134,84 @@ func StartServer(port string, processor *core.JobProcessor) {
 		c.JSON(http.StatusOK, gin.H{"status": "UP"})
 	})
 	r.GET("/actuator/health/readiness", func(c *gin.Context) {
+		if !ready.Load() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "DOWN"})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{"status": "UP"})
 	})
 
-	r.Run(":" + port)
+	// Metrics only hold counters and stay open like the health endpoints, so
+	// that scrapers do not need a token
+	r.GET("/actuator/metrics", func(c *gin.Context) {
+		metrics := gin.H{"queue": gin.H{"pending": queue.Pending()}}
+		if cache := processor.PluginCache; cache != nil {
+			hits, misses := cache.Stats()
+			hitRate := 0.0
+			if hits+misses > 0 {
+				hitRate = float64(hits) / float64(hits+misses)
+			}
+			metrics["pluginCache"] = gin.H{"hits": hits, "misses": misses, "hitRate": hitRate}
+		}
+		c.JSON(http.StatusOK, metrics)
+	})
+
+	srv := &http.Server{
+		Addr:      ":" + port,
+		Handler:   r,
+		TLSConfig: tlsCfg,
+	}
+	// Log streams follow jobs for as long as they run, they are ended on
+	// shutdown so that they do not hold it up
+	srv.RegisterOnShutdown(stopStreams)
+
+	go func() {
+		var err error
+		if tlsCfg != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutdown signal received, no longer accepting jobs")
+	ready.Store(false)
+
+	drain(queue, processor)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shutdown server: %v", err)
+	}
+	log.Println("Server stopped")
+}
+
+// drain fails the queued jobs, waits for the running ones up to the drain
+// timeout and then cancels whatever is still running
+func drain(queue *JobQueue, processor *core.JobProcessor) {
+	for _, job := range queue.Close() {
+		log.Printf("Failing queued job %s: %v", job.JobId, core.ErrShuttingDown)
+		processor.Tracker.Finish(job, core.ResultFailed, core.ErrShuttingDown)
+		if err := processor.Status.SetCompleted(context.Background(), job, processor.JobToken(job), false, "Error: "+core.ErrShuttingDown.Error()); err != nil {
+			log.Printf("Failed to set completed status: %v", err)
+		}
+	}
+
+	log.Printf("Waiting up to %s for running jobs to finish", processor.Config.DrainTimeout)
+	if queue.Wait(processor.Config.DrainTimeout) {
+		return
+	}
+
+	cancelled := processor.CancelAll(core.ErrShuttingDown)
+	log.Printf("Drain timeout expired, cancelled %d running jobs", cancelled)
+
+	// Give terraform the grace period to release its locks and the job time to report its status
+	if !queue.Wait(processor.Config.CancelGracePeriod + 15*time.Second) {
+		log.Println("Running jobs did not stop in time")
+	}
 }
@@ -1,25 +1,74 @@
 package model
 
+// Command is a script of a step. In terraform steps, commands flagged Before or
+// After run as hooks around the terraform phase named by Phase ("init", "plan",
+// "apply" or "destroy"). Before hooks default to init and After hooks to the
+// step's main command.
+//
+// Runtime selects the interpreter: SH (default), BASH, PYTHON or SHEBANG, the
+// latter executing the script through its own #! line. With File set the script
+// is written to a temporary file that is executed instead of being passed inline.
 type Command struct {
-	Priority int    `json:"priority"`
-	Script   string `json:"script"`
+	Priority        int               `json:"priority"`
+	Script          string            `json:"script"`
+	Before          bool              `json:"before,omitempty"`
+	After           bool              `json:"after,omitempty"`
+	Phase           string            `json:"phase,omitempty"`
+	Runtime         string            `json:"runtime,omitempty"`
+	File            bool              `json:"file,omitempty"`
+	WorkingDir      string            `json:"workingDir,omitempty"`
+	Env             map[string]string `json:"env,omitempty"`
+	ContinueOnError bool              `json:"continueOnError,omitempty"`
+}
+
+// Timeouts overrides the executor's default timeouts for a single job.
+// Values are Go duration strings such as "30m" or "1h30m"; "0" disables the timeout.
+type Timeouts struct {
+	Job       string `json:"job,omitempty"`
+	Clone     string `json:"clone,omitempty"`
+	Install   string `json:"install,omitempty"`
+	Init      string `json:"init,omitempty"`
+	Execution string `json:"execution,omitempty"`
+	Scripts   string `json:"scripts,omitempty"`
+}
+
+// PlanSummary counts the resource changes of a plan and lists the resource addresses per action
+type PlanSummary struct {
+	Add       int                  `json:"add"`
+	Change    int                  `json:"change"`
+	Destroy   int                  `json:"destroy"`
+	Replace   int                  `json:"replace"`
+	Resources PlanSummaryResources `json:"resources"`
+}
+
+type PlanSummaryResources struct {
+	Add     []string `json:"add"`
+	Change  []string `json:"change"`
+	Destroy []string `json:"destroy"`
+	Replace []string `json:"replace"`
 }
 
 type TerraformJob struct {
-	CommandList          []Command         `json:"commandList"`
-	Type                 string            `json:"type"`
-	OverrideBackend      bool              `json:"overrideBackend"`
-	TerraformOutput      string            `json:"terraformOutput,omitempty"`
-	OrganizationId       string            `json:"organizationId"`
-	WorkspaceId          string            `json:"workspaceId"`
-	JobId                string            `json:"jobId"`
-	StepId               string            `json:"stepId"`
-	TerraformVersion     string            `json:"terraformVersion"`
-	Source               string            `json:"source"`
-	Branch               string            `json:"branch"`
-	Folder               string            `json:"folder"`
-	VcsType              string            `json:"vcsType"`
-	AccessToken          string            `json:"accessToken"`
-	EnvironmentVariables map[string]string `json:"environmentVariables"`
-	Variables            map[string]string `json:"variables"`
+	CommandList          []Command           `json:"commandList"`
+	Type                 string              `json:"type"`
+	OverrideBackend      bool                `json:"overrideBackend"`
+	TerraformOutput      string              `json:"terraformOutput,omitempty"`
+	OrganizationId       string              `json:"organizationId"`
+	WorkspaceId          string              `json:"workspaceId"`
+	JobId                string              `json:"jobId"`
+	StepId               string              `json:"stepId"`
+	TerraformVersion     string              `json:"terraformVersion"`
+	Tofu                 bool                `json:"tofu"`
+	Source               string              `json:"source"`
+	Branch               string              `json:"branch"`
+	Folder               string              `json:"folder"`
+	VcsType              string              `json:"vcsType"`
+	AccessToken          string              `json:"accessToken"`
+	EnvironmentVariables map[string]string   `json:"environmentVariables"`
+	Variables            map[string]Variable `json:"variables"`
+	Timeouts             *Timeouts           `json:"timeouts,omitempty"`
+	// PlanStepId is the step that produced the plan a terraformApply job must apply
+	PlanStepId  string       `json:"planStepId,omitempty"`
+	PlanSummary *PlanSummary `json:"planSummary,omitempty"`
+	HasChanges  *bool        `json:"hasChanges,omitempty"`
 }
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+const (
+	// VariableTypeString values are passed to terraform as plain strings
+	VariableTypeString = "string"
+	// VariableTypeHCL values are HCL expressions such as lists, maps or objects
+	VariableTypeHCL = "hcl"
+	// VariableTypeJSON values are JSON documents
+	VariableTypeJSON = "json"
+)
+
+// Variable is a terraform input variable of a job. It can be sent either as a
+// plain string or as an object with a type and a sensitive flag.
+type Variable struct {
+	Value     string `json:"value"`
+	Type      string `json:"type,omitempty"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+}
+
+func (v *Variable) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		v.Type = VariableTypeString
+		return json.Unmarshal(data, &v.Value)
+	}
+
+	type plain Variable
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*v = Variable(p)
+	if v.Type == "" {
+		v.Type = VariableTypeString
+	}
+	return nil
+}
@@ -1,42 +1,179 @@
 package script
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/ilkerispir/terrakube-executor/internal/logs"
 	"github.com/ilkerispir/terrakube-executor/internal/model"
 )
 
+// Hook placements around a terraform phase
+const (
+	Before = "before"
+	After  = "after"
+)
+
 type Executor struct {
 	Job        *model.TerraformJob
 	WorkingDir string
 	Streamer   logs.LogStreamer
+	Env        map[string]string
+	// GracePeriod is how long a script is given to exit after SIGINT before it is killed
+	GracePeriod time.Duration
+	// ScriptDir is where scripts run from a file are written, the system
+	// temporary directory when empty
+	ScriptDir string
 }
 
-func NewExecutor(job *model.TerraformJob, workingDir string, streamer logs.LogStreamer) *Executor {
+func NewExecutor(job *model.TerraformJob, workingDir string, streamer logs.LogStreamer, env map[string]string, gracePeriod time.Duration) *Executor {
 	return &Executor{
-		Job:        job,
-		WorkingDir: workingDir,
-		Streamer:   streamer,
+		Job:         job,
+		WorkingDir:  workingDir,
+		Streamer:    streamer,
+		Env:         env,
+		GracePeriod: gracePeriod,
 	}
 }
 
-func (e *Executor) Execute() error {
-	for _, command := range e.Job.CommandList {
-		cmd := exec.Command("sh", "-c", command.Script)
-		cmd.Dir = e.WorkingDir
-		cmd.Env = os.Environ() // TODO: Inject job vars
+// Execute runs every command of the job by ascending priority
+func (e *Executor) Execute(ctx context.Context) error {
+	for _, command := range e.sortedCommands() {
+		if err := e.run(ctx, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		if e.Streamer != nil {
-			cmd.Stdout = e.Streamer
-			cmd.Stderr = e.Streamer
+// RunHooks runs by ascending priority the commands placed before or after the
+// given terraform phase. mainPhase is the step's terraform command, the default
+// phase of After hooks.
+func (e *Executor) RunHooks(ctx context.Context, placement, phase, mainPhase string) error {
+	for _, command := range e.sortedCommands() {
+		if !hookMatches(command, placement, phase, mainPhase) {
+			continue
 		}
+		log.Printf("Running %s %s hook for job %s", placement, phase, e.Job.JobId)
+		if err := e.run(ctx, command); err != nil {
+			return fmt.Errorf("%s %s hook failed: %w", placement, phase, err)
+		}
+	}
+	return nil
+}
 
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("script execution failed: %s: %w", command.Script, err)
+// ValidateHooks checks that every command of a terraform step runs as a hook:
+// it must be placed before or after a phase, and that phase must be init or
+// the step's main phase.
+func ValidateHooks(commands []model.Command, mainPhase string) error {
+	for i, command := range commands {
+		if !command.Before && !command.After {
+			return fmt.Errorf("command %d (priority %d) is neither before nor after a terraform phase and would never run", i, command.Priority)
+		}
+		if command.Phase != "" && command.Phase != "init" && command.Phase != mainPhase {
+			return fmt.Errorf("command %d (priority %d) is placed around phase %q, this step only runs init and %s", i, command.Priority, command.Phase, mainPhase)
 		}
 	}
 	return nil
 }
+
+func hookMatches(command model.Command, placement, phase, mainPhase string) bool {
+	switch placement {
+	case Before:
+		if !command.Before {
+			return false
+		}
+		if command.Phase == "" {
+			return phase == "init"
+		}
+	case After:
+		if !command.After {
+			return false
+		}
+		if command.Phase == "" {
+			return phase == mainPhase
+		}
+	default:
+		return false
+	}
+	return command.Phase == phase
+}
+
+func (e *Executor) sortedCommands() []model.Command {
+	commands := make([]model.Command, len(e.Job.CommandList))
+	copy(commands, e.Job.CommandList)
+	sort.SliceStable(commands, func(i, j int) bool {
+		return commands[i].Priority < commands[j].Priority
+	})
+	return commands
+}
+
+func (e *Executor) run(ctx context.Context, command model.Command) error {
+	cmd, cleanup, err := newCommand(ctx, command, e.ScriptDir)
+	if err != nil {
+		return fmt.Errorf("script execution failed: %s: %w", command.Script, err)
+	}
+	defer cleanup()
+
+	cmd.Dir = e.WorkingDir
+	if command.WorkingDir != "" {
+		cmd.Dir = command.WorkingDir
+		if !filepath.IsAbs(cmd.Dir) {
+			cmd.Dir = filepath.Join(e.WorkingDir, cmd.Dir)
+		}
+	}
+	cmd.Env = e.environ(command.Env)
+	stopKill := configureCancel(cmd, e.GracePeriod)
+
+	if e.Streamer != nil {
+		cmd.Stdout = e.Streamer
+		cmd.Stderr = e.Streamer
+	}
+
+	err = cmd.Run()
+	stopKill()
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("script execution interrupted: %s: %w", command.Script, context.Cause(ctx))
+		}
+		if command.ContinueOnError {
+			log.Printf("Script failed for job %s, continuing: %v", e.Job.JobId, err)
+			if e.Streamer != nil {
+				fmt.Fprintf(e.Streamer, "\nScript failed, continuing: %v\n", err)
+			}
+			return nil
+		}
+		return fmt.Errorf("script execution failed: %s: %w", command.Script, err)
+	}
+	return nil
+}
+
+// environ merges the command's overrides into the executor environment
+func (e *Executor) environ(overrides map[string]string) []string {
+	env := e.Env
+	if env == nil {
+		env = make(map[string]string)
+		for _, kv := range os.Environ() {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				env[k] = v
+			}
+		}
+	}
+
+	environ := make([]string, 0, len(env)+len(overrides))
+	for k, v := range env {
+		if _, ok := overrides[k]; !ok {
+			environ = append(environ, k+"="+v)
+		}
+	}
+	for k, v := range overrides {
+		environ = append(environ, k+"="+v)
+	}
+	return environ
+}
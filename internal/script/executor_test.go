@@ -0,0 +1,97 @@
+package script
+
+import (
+	"testing"
+
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+func TestHookMatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		command   model.Command
+		placement string
+		phase     string
+		mainPhase string
+		want      bool
+	}{
+		{"before defaults to init", model.Command{Before: true}, Before, "init", "plan", true},
+		{"before does not default to the main phase", model.Command{Before: true}, Before, "plan", "plan", false},
+		{"after defaults to the main phase", model.Command{After: true}, After, "apply", "apply", true},
+		{"after does not default to init", model.Command{After: true}, After, "init", "plan", false},
+		{"before an explicit phase", model.Command{Before: true, Phase: "plan"}, Before, "plan", "plan", true},
+		{"before another phase", model.Command{Before: true, Phase: "plan"}, Before, "init", "plan", false},
+		{"after init", model.Command{After: true, Phase: "init"}, After, "init", "plan", true},
+		{"after init is not after the main phase", model.Command{After: true, Phase: "init"}, After, "plan", "plan", false},
+		{"before only is not after", model.Command{Before: true}, After, "plan", "plan", false},
+		{"after only is not before", model.Command{After: true}, Before, "init", "plan", false},
+		{"before and after", model.Command{Before: true, After: true, Phase: "destroy"}, After, "destroy", "destroy", true},
+		{"neither", model.Command{}, Before, "init", "plan", false},
+		{"unknown placement", model.Command{Before: true, After: true}, "during", "init", "plan", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hookMatches(tt.command, tt.placement, tt.phase, tt.mainPhase); got != tt.want {
+				t.Errorf("hookMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateHooks(t *testing.T) {
+	tests := []struct {
+		name      string
+		commands  []model.Command
+		mainPhase string
+		wantErr   bool
+	}{
+		{
+			name:      "no commands",
+			mainPhase: "plan",
+		},
+		{
+			name: "default phases",
+			commands: []model.Command{
+				{Before: true},
+				{After: true},
+			},
+			mainPhase: "plan",
+		},
+		{
+			name: "init and the main phase",
+			commands: []model.Command{
+				{After: true, Phase: "init"},
+				{Before: true, Phase: "apply"},
+			},
+			mainPhase: "apply",
+		},
+		{
+			name:      "neither before nor after",
+			commands:  []model.Command{{Before: true}, {Priority: 20}},
+			mainPhase: "plan",
+			wantErr:   true,
+		},
+		{
+			name:      "phase the step does not run",
+			commands:  []model.Command{{After: true, Phase: "apply"}},
+			mainPhase: "plan",
+			wantErr:   true,
+		},
+		{
+			name:      "unknown phase",
+			commands:  []model.Command{{Before: true, Phase: "validate"}},
+			mainPhase: "destroy",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateHooks(tt.commands, tt.mainPhase)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateHooks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
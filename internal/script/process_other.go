@@ -0,0 +1,15 @@
+//go:build !unix
+
+package script
+
+import (
+	"os/exec"
+	"time"
+)
+
+// configureCancel falls back to killing the process, as process groups and
+// SIGINT are not available on this platform.
+func configureCancel(cmd *exec.Cmd, gracePeriod time.Duration) func() {
+	cmd.WaitDelay = gracePeriod
+	return func() {}
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package script
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// configureCancel runs the command in its own process group so that on
+// cancellation SIGINT reaches every child of the shell, not only the shell itself.
+// The whole group is killed if it is still around after gracePeriod.
+//
+// The returned function must be called once the command has been waited for,
+// so that the kill cannot hit a new process group reusing the pid.
+func configureCancel(cmd *exec.Cmd, gracePeriod time.Duration) func() {
+	var (
+		mu    sync.Mutex
+		timer *time.Timer
+	)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		mu.Lock()
+		timer = time.AfterFunc(gracePeriod, func() {
+			syscall.Kill(pgid, syscall.SIGKILL)
+		})
+		mu.Unlock()
+		return syscall.Kill(pgid, syscall.SIGINT)
+	}
+	cmd.WaitDelay = gracePeriod
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+// interpreters maps the supported runtimes to their command
+var interpreters = map[string]string{
+	"SH":     "sh",
+	"BASH":   "bash",
+	"PYTHON": "python3",
+}
+
+// newCommand builds the process running a command with its runtime. The
+// returned cleanup function removes the script file, if one was written to dir.
+func newCommand(ctx context.Context, command model.Command, dir string) (*exec.Cmd, func(), error) {
+	runtime := strings.ToUpper(command.Runtime)
+	if runtime == "" {
+		runtime = "SH"
+	}
+
+	if runtime == "SHEBANG" {
+		if !strings.HasPrefix(command.Script, "#!") {
+			return nil, nil, fmt.Errorf("runtime SHEBANG requires the script to start with #!")
+		}
+		path, err := writeScript(dir, command.Script, 0700)
+		if err != nil {
+			return nil, nil, err
+		}
+		return exec.CommandContext(ctx, path), func() { os.Remove(path) }, nil
+	}
+
+	interpreter, ok := interpreters[runtime]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported runtime: %s", command.Runtime)
+	}
+
+	if !command.File {
+		return exec.CommandContext(ctx, interpreter, "-c", command.Script), func() {}, nil
+	}
+
+	path, err := writeScript(dir, command.Script, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return exec.CommandContext(ctx, interpreter, path), func() { os.Remove(path) }, nil
+}
+
+// writeScript stores the script body in a new file of dir, which is created if needed
+func writeScript(dir, body string, perm os.FileMode) (string, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", fmt.Errorf("failed to create script dir: %w", err)
+		}
+	}
+	f, err := os.CreateTemp(dir, "terrakube-script-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create script file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(body); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write script file: %w", err)
+	}
+	if err := f.Chmod(perm); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to set script file permissions: %w", err)
+	}
+	return f.Name(), nil
+}
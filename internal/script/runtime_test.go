@@ -0,0 +1,128 @@
+//go:build unix
+
+package script
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+// bufferStreamer collects the output of the commands
+type bufferStreamer struct {
+	bytes.Buffer
+}
+
+func (b *bufferStreamer) Close() error { return nil }
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name       string
+		commands   []model.Command
+		env        map[string]string
+		wantOutput string
+		wantErr    string
+	}{
+		{
+			name: "ascending priority",
+			commands: []model.Command{
+				{Priority: 30, Script: "echo third"},
+				{Priority: 10, Script: "echo first"},
+				{Priority: 20, Script: "echo second"},
+			},
+			wantOutput: "first\nsecond\nthird\n",
+		},
+		{
+			name: "failure stops the step",
+			commands: []model.Command{
+				{Priority: 10, Script: "exit 3"},
+				{Priority: 20, Script: "echo unreachable"},
+			},
+			wantErr: "script execution failed",
+		},
+		{
+			name: "continue on error",
+			commands: []model.Command{
+				{Priority: 10, Script: "exit 3", ContinueOnError: true},
+				{Priority: 20, Script: "echo next"},
+			},
+			wantOutput: "\nScript failed, continuing: exit status 3\nnext\n",
+		},
+		{
+			name: "command env overrides the executor env",
+			commands: []model.Command{
+				{Script: `echo "$REGION $STAGE"`, Env: map[string]string{"STAGE": "prod"}},
+			},
+			env:        map[string]string{"REGION": "eu-west-1", "STAGE": "dev"},
+			wantOutput: "eu-west-1 prod\n",
+		},
+		{
+			name:       "bash runtime",
+			commands:   []model.Command{{Script: `echo "${BASH_VERSION:+bash}"`, Runtime: "bash"}},
+			wantOutput: "bash\n",
+		},
+		{
+			name:       "shebang",
+			commands:   []model.Command{{Script: "#!/bin/sh\necho shebang", Runtime: "SHEBANG"}},
+			wantOutput: "shebang\n",
+		},
+		{
+			name:     "shebang without #!",
+			commands: []model.Command{{Script: "echo shebang", Runtime: "SHEBANG"}},
+			wantErr:  "requires the script to start with #!",
+		},
+		{
+			name:     "unsupported runtime",
+			commands: []model.Command{{Script: "puts 1", Runtime: "RUBY"}},
+			wantErr:  "unsupported runtime",
+		},
+		{
+			name:       "file script is private",
+			commands:   []model.Command{{Script: `ls -l "$0" | cut -c1-10`, File: true}},
+			wantOutput: "-rw-------\n",
+		},
+		{
+			name:       "shebang script is executable by its owner only",
+			commands:   []model.Command{{Script: "#!/bin/sh\nls -l \"$0\" | cut -c1-10", Runtime: "SHEBANG"}},
+			wantOutput: "-rwx------\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"PATH": os.Getenv("PATH")}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			var out bufferStreamer
+			job := &model.TerraformJob{JobId: "job", CommandList: tt.commands}
+			e := NewExecutor(job, t.TempDir(), &out, env, 0)
+			e.ScriptDir = t.TempDir()
+
+			err := e.Execute(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tt.wantOutput {
+				t.Errorf("got output %q, want %q", out.String(), tt.wantOutput)
+			}
+
+			// Script files are removed once they ran
+			entries, err := os.ReadDir(e.ScriptDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("script dir still holds %d files", len(entries))
+			}
+		})
+	}
+}
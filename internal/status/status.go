@@ -1,19 +1,21 @@
 package status
 
 import (
+	"context"
 	"fmt"
-
 	"log"
 
-	"github.com/ilkerispir/terrakube-executor/internal/auth"
 	"github.com/ilkerispir/terrakube-executor/internal/client"
 	"github.com/ilkerispir/terrakube-executor/internal/config"
 	"github.com/ilkerispir/terrakube-executor/internal/model"
 )
 
+// StatusService reports job progress to Terrakube, authenticating with the
+// token of the job
 type StatusService interface {
-	SetRunning(job *model.TerraformJob) error
-	SetCompleted(job *model.TerraformJob, success bool, output string) error
+	SetRunning(ctx context.Context, job *model.TerraformJob, token string) error
+	SetCompleted(ctx context.Context, job *model.TerraformJob, token string, success bool, output string) error
+	SetCancelled(ctx context.Context, job *model.TerraformJob, token string, output string) error
 }
 
 type Service struct {
@@ -21,26 +23,44 @@ type Service struct {
 }
 
 func NewStatusService(cfg *config.Config) *Service {
-	token, err := auth.GenerateTerrakubeToken(cfg.InternalSecret)
-	if err != nil {
-		log.Printf("Warning: failed to generate Terrakube token for API requests: %v", err)
-	}
 	return &Service{
-		client: client.NewTerrakubeClient(cfg.TerrakubeApiUrl, token),
+		client: client.NewTerrakubeClient(cfg.TerrakubeApiUrl, ""),
 	}
 }
 
-func (s *Service) SetRunning(job *model.TerraformJob) error {
-	return s.client.UpdateJobStatus(job.OrganizationId, job.JobId, "running", "")
+func (s *Service) SetRunning(ctx context.Context, job *model.TerraformJob, token string) error {
+	return s.client.UpdateJobStatus(ctx, token, job.OrganizationId, job.JobId, "running", "")
 }
 
-func (s *Service) SetCompleted(job *model.TerraformJob, success bool, output string) error {
+func (s *Service) SetCompleted(ctx context.Context, job *model.TerraformJob, token string, success bool, output string) error {
 	status := "completed"
 	if !success {
 		status = "failed"
 	}
-	if err := s.client.UpdateStepStatus(job.OrganizationId, job.JobId, job.StepId, status, output); err != nil {
+	if err := s.client.UpdateStepStatus(ctx, token, job.OrganizationId, job.JobId, job.StepId, status, output); err != nil {
+		return fmt.Errorf("failed to update step status: %w", err)
+	}
+	s.reportPlan(ctx, job, token)
+	return s.client.UpdateJobStatus(ctx, token, job.OrganizationId, job.JobId, status, "")
+}
+
+// reportPlan stores whether the plan has changes in the planChanges attribute
+// of the job, which Terrakube uses to skip applying plans without changes. It
+// is best effort: the step status was already reported and a rejected PATCH
+// must not fail it.
+func (s *Service) reportPlan(ctx context.Context, job *model.TerraformJob, token string) {
+	if job.HasChanges != nil {
+		if err := s.client.UpdateJob(ctx, token, job.OrganizationId, job.JobId, map[string]interface{}{
+			"planChanges": *job.HasChanges,
+		}); err != nil {
+			log.Printf("Failed to report plan changes of job %s: %v", job.JobId, err)
+		}
+	}
+}
+
+func (s *Service) SetCancelled(ctx context.Context, job *model.TerraformJob, token string, output string) error {
+	if err := s.client.UpdateStepStatus(ctx, token, job.OrganizationId, job.JobId, job.StepId, "cancelled", output); err != nil {
 		return fmt.Errorf("failed to update step status: %w", err)
 	}
-	return s.client.UpdateJobStatus(job.OrganizationId, job.JobId, status, "")
+	return s.client.UpdateJobStatus(ctx, token, job.OrganizationId, job.JobId, "cancelled", "")
 }
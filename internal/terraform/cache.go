@@ -0,0 +1,131 @@
+package terraform
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// recentlyUsed keeps versions that were just installed or used from being
+// evicted, versions in use are protected by the lease of their jobs
+const recentlyUsed = time.Hour
+
+type cachedVersion struct {
+	tool     Tool
+	version  string
+	dir      string
+	size     int64
+	lastUsed time.Time
+}
+
+// touch records the use of an installed version for the LRU eviction
+func touch(installDir string) {
+	now := time.Now()
+	if err := os.Chtimes(installDir, now, now); err != nil {
+		log.Printf("Failed to update last use of %s: %v", installDir, err)
+	}
+}
+
+// evict removes the least recently used versions until the cache is within
+// the configured number of versions and size
+func (vm *VersionManager) evict(ctx context.Context) {
+	maxVersions := vm.Config.CacheMaxVersions
+	maxSize := int64(vm.Config.CacheMaxSizeMB) * 1024 * 1024
+	if maxVersions <= 0 && maxSize <= 0 {
+		return
+	}
+
+	cached := vm.cachedVersions()
+	var total int64
+	for _, c := range cached {
+		total += c.size
+	}
+
+	// Oldest first
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].lastUsed.Before(cached[j].lastUsed)
+	})
+
+	count := len(cached)
+	for _, c := range cached {
+		if (maxVersions <= 0 || count <= maxVersions) && (maxSize <= 0 || total <= maxSize) {
+			return
+		}
+		if time.Since(c.lastUsed) < recentlyUsed {
+			log.Printf("Binary cache is over its limits but remaining versions were used recently")
+			return
+		}
+
+		// Versions leased by running jobs are skipped
+		lockPath := c.dir + ".lock"
+		unlock, ok, err := tryLockFile(ctx, lockPath)
+		if err != nil {
+			log.Printf("Failed to lock %s %s for eviction: %v", c.tool, c.version, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		err = os.RemoveAll(c.dir)
+		if err == nil {
+			os.Remove(lockPath)
+		}
+		unlock()
+		if err != nil {
+			log.Printf("Failed to evict %s %s: %v", c.tool, c.version, err)
+			continue
+		}
+
+		log.Printf("Evicted %s %s from the binary cache", c.tool, c.version)
+		count--
+		total -= c.size
+	}
+}
+
+func (vm *VersionManager) cachedVersions() []cachedVersion {
+	var cached []cachedVersion
+	for _, tool := range []Tool{Terraform, OpenTofu} {
+		entries, err := os.ReadDir(filepath.Join(vm.CacheDir, string(tool)))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			// Hidden directories are installs in progress
+			if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			dir := filepath.Join(vm.CacheDir, string(tool), entry.Name())
+			cached = append(cached, cachedVersion{
+				tool:     tool,
+				version:  entry.Name(),
+				dir:      dir,
+				size:     dirSize(dir),
+				lastUsed: info.ModTime(),
+			})
+		}
+	}
+	return cached
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,73 @@
+//go:build unix
+
+package terraform
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ilkerispir/terrakube-executor/internal/config"
+)
+
+func TestEvictSkipsLeasedVersions(t *testing.T) {
+	vm := &VersionManager{
+		CacheDir: t.TempDir(),
+		Config:   &config.Config{CacheMaxVersions: 1},
+	}
+	ctx := context.Background()
+
+	old := time.Now().Add(-2 * recentlyUsed)
+	dirs := map[string]string{}
+	for _, ver := range []string{"1.5.0", "1.6.0", "1.7.0"} {
+		dir := filepath.Join(vm.CacheDir, string(Terraform), ver)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, string(Terraform)), []byte("bin"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(dir, old, old); err != nil {
+			t.Fatal(err)
+		}
+		dirs[ver] = dir
+	}
+
+	release, err := vm.lease(ctx, dirs["1.5.0"], filepath.Join(dirs["1.5.0"], string(Terraform)))
+	if err != nil || release == nil {
+		t.Fatalf("lease() failed: %v", err)
+	}
+	defer release()
+	// Leasing records a use, make the leased version the least recently used again
+	if err := os.Chtimes(dirs["1.5.0"], old, old); err != nil {
+		t.Fatal(err)
+	}
+	// An install in progress is not a cached version
+	if err := os.MkdirAll(filepath.Join(vm.CacheDir, string(Terraform), ".1.8.0.tmp-1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	vm.evict(ctx)
+
+	// The leased version is kept even though the cache stays over its limit
+	tests := []struct {
+		version string
+		kept    bool
+	}{
+		{"1.5.0", true},
+		{"1.6.0", false},
+		{"1.7.0", false},
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(dirs[tt.version])
+		if kept := err == nil; kept != tt.kept {
+			t.Errorf("version %s kept = %v, want %v", tt.version, kept, tt.kept)
+		}
+		_, err = os.Stat(dirs[tt.version] + ".lock")
+		if !tt.kept && err == nil {
+			t.Errorf("lock file of evicted version %s was not removed", tt.version)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Provider installation method types of the CLI configuration
+const (
+	NetworkMirror    = "network_mirror"
+	FilesystemMirror = "filesystem_mirror"
+	Direct           = "direct"
+)
+
+// InstallationMethod is a provider_installation method. Location is the URL of
+// a network mirror or the path of a filesystem mirror.
+type InstallationMethod struct {
+	Type     string
+	Location string
+	Include  []string
+	Exclude  []string
+}
+
+// CLIConfig is the terraform CLI configuration of a job
+type CLIConfig struct {
+	// Credentials maps hostnames to their API token
+	Credentials map[string]string
+	// Installation lists the provider installation methods, terraform uses its
+	// default installation when empty
+	Installation []InstallationMethod
+}
+
+// Render returns the configuration in HCL, empty if there is nothing to configure
+func (c *CLIConfig) Render() string {
+	var b strings.Builder
+
+	hosts := make([]string, 0, len(c.Credentials))
+	for host := range c.Credentials {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		fmt.Fprintf(&b, "credentials %s {\n  token = %s\n}\n", hclString(host), hclString(c.Credentials[host]))
+	}
+
+	if len(c.Installation) > 0 {
+		b.WriteString("provider_installation {\n")
+		for _, m := range c.Installation {
+			fmt.Fprintf(&b, "  %s {\n", m.Type)
+			switch m.Type {
+			case NetworkMirror:
+				fmt.Fprintf(&b, "    url = %s\n", hclString(m.Location))
+			case FilesystemMirror:
+				fmt.Fprintf(&b, "    path = %s\n", hclString(m.Location))
+			}
+			if len(m.Include) > 0 {
+				fmt.Fprintf(&b, "    include = %s\n", hclList(m.Include))
+			}
+			if len(m.Exclude) > 0 {
+				fmt.Fprintf(&b, "    exclude = %s\n", hclList(m.Exclude))
+			}
+			b.WriteString("  }\n")
+		}
+		b.WriteString("}\n")
+	}
+
+	return b.String()
+}
+
+func hclList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = hclString(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// hclString quotes s as an HCL string literal, escaping template sequences
+func hclString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+
+	quoted := strings.TrimSuffix(buf.String(), "\n")
+	quoted = strings.ReplaceAll(quoted, "${", "$${")
+	quoted = strings.ReplaceAll(quoted, "%{", "%%{")
+	return quoted
+}
@@ -4,56 +4,69 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform-exec/tfexec"
 	"github.com/ilkerispir/terrakube-executor/internal/logs"
 	"github.com/ilkerispir/terrakube-executor/internal/model"
 )
 
+// PlanFileName is the saved plan written by terraformPlan jobs in the working directory
+const PlanFileName = "terraform.tfplan"
+
 type Executor struct {
 	Job        *model.TerraformJob
 	WorkingDir string
 	Streamer   logs.LogStreamer
 	ExecPath   string
+	// Env is the environment of terraform. The auto.tfvars files written with the
+	// job variables take precedence over its TF_VAR_* entries.
+	Env map[string]string
+	// GracePeriod is how long terraform is given to exit after SIGINT before it is killed
+	GracePeriod time.Duration
+	// PlanFile is the saved plan applied by terraformApply, a fresh apply runs when empty
+	PlanFile string
+	// Upgrade runs init with -upgrade, ignoring the provider versions of the dependency lock file
+	Upgrade bool
+	// PluginCacheDir is the provider plugin cache used by init, none when empty
+	PluginCacheDir string
 }
 
-func NewExecutor(job *model.TerraformJob, workingDir string, streamer logs.LogStreamer, execPath string) *Executor {
+func NewExecutor(job *model.TerraformJob, workingDir string, streamer logs.LogStreamer, execPath string, env map[string]string, gracePeriod time.Duration) *Executor {
 	return &Executor{
-		Job:        job,
-		WorkingDir: workingDir,
-		Streamer:   streamer,
-		ExecPath:   execPath,
+		Job:         job,
+		WorkingDir:  workingDir,
+		Streamer:    streamer,
+		ExecPath:    execPath,
+		Env:         env,
+		GracePeriod: gracePeriod,
 	}
 }
 
-func (e *Executor) Execute() error {
+func (e *Executor) newTerraform() (*tfexec.Terraform, error) {
 	tf, err := tfexec.NewTerraform(e.WorkingDir, e.ExecPath)
 	if err != nil {
-		return fmt.Errorf("error running NewTerraform: %s", err)
+		return nil, fmt.Errorf("error running NewTerraform: %s", err)
 	}
 
-	// Set Environment Variables
-	env := make(map[string]string)
-
-	// Parse OS environment
-	for _, e := range os.Environ() {
-		for i := 0; i < len(e); i++ {
-			if e[i] == '=' {
-				env[e[:i]] = e[i+1:]
-				break
-			}
+	if e.GracePeriod > 0 {
+		if err := tf.SetWaitDelay(e.GracePeriod); err != nil {
+			return nil, fmt.Errorf("error setting terraform grace period: %s", err)
 		}
 	}
 
-	for k, v := range e.Job.EnvironmentVariables {
+	// Set Environment Variables, without the ones tfexec manages itself
+	env := make(map[string]string, len(e.Env))
+	for k, v := range e.Env {
 		env[k] = v
 	}
-	for k, v := range e.Job.Variables {
-		env[fmt.Sprintf("TF_VAR_%s", k)] = v
+	if e.PluginCacheDir != "" {
+		env["TF_PLUGIN_CACHE_DIR"] = e.PluginCacheDir
+	}
+	if err := tf.SetEnv(tfexec.CleanEnv(env)); err != nil {
+		return nil, fmt.Errorf("error setting terraform environment: %s", err)
 	}
-
-	tf.SetEnv(env)
 
 	// Set Log Streaming
 	if e.Streamer != nil {
@@ -61,21 +74,48 @@ func (e *Executor) Execute() error {
 		tf.SetStderr(e.Streamer)
 	}
 
-	ctx := context.Background()
+	return tf, nil
+}
+
+// Init runs terraform init. Cancelling ctx sends SIGINT to terraform so it can
+// release state locks, escalating to SIGKILL after GracePeriod.
+func (e *Executor) Init(ctx context.Context) error {
+	tf, err := e.newTerraform()
+	if err != nil {
+		return err
+	}
 
-	// Init
-	err = tf.Init(ctx, tfexec.Upgrade(true))
+	err = tf.Init(ctx, tfexec.Upgrade(e.Upgrade))
 	if err != nil {
 		return fmt.Errorf("error running Init: %s", err)
 	}
+	return nil
+}
+
+// Run runs the terraform command of the job against an initialized working directory
+func (e *Executor) Run(ctx context.Context) error {
+	tf, err := e.newTerraform()
+	if err != nil {
+		return err
+	}
 
 	switch e.Job.Type {
 	case "terraformPlan":
-		_, err = tf.Plan(ctx)
+		// Plan runs with -detailed-exitcode, exit code 2 reports pending changes
+		var hasChanges bool
+		hasChanges, err = tf.Plan(ctx, tfexec.Out(PlanFileName))
+		if err == nil {
+			e.Job.HasChanges = &hasChanges
+		}
 	case "terraformApply":
-		// Apply should probably use the plan if available?
-		// For now standard apply
-		err = tf.Apply(ctx)
+		if e.PlanFile == "" {
+			err = tf.Apply(ctx)
+			break
+		}
+		err = tf.Apply(ctx, tfexec.DirOrPlan(e.PlanFile))
+		if err != nil && isStalePlan(err) {
+			return fmt.Errorf("saved plan is stale, the state changed since it was created: %s", err)
+		}
 	case "terraformDestroy":
 		err = tf.Destroy(ctx)
 	default:
@@ -89,19 +129,13 @@ func (e *Executor) Execute() error {
 	return nil
 }
 
-func (e *Executor) Output() (string, error) {
-	tf, err := tfexec.NewTerraform(e.WorkingDir, e.ExecPath)
+func (e *Executor) Output(ctx context.Context) (string, error) {
+	tf, err := e.newTerraform()
 	if err != nil {
-		return "", fmt.Errorf("error running NewTerraform: %s", err)
-	}
-
-	// Set Log Streaming (Optional for Output)
-	if e.Streamer != nil {
-		tf.SetStdout(e.Streamer)
-		tf.SetStderr(e.Streamer)
+		return "", err
 	}
 
-	output, err := tf.Output(context.Background())
+	output, err := tf.Output(ctx)
 	if err != nil {
 		return "", fmt.Errorf("error running Output: %s", err)
 	}
@@ -121,3 +155,20 @@ func (e *Executor) Output() (string, error) {
 
 	return string(bytes), nil
 }
+
+// stalePlanMessages are the diagnostics terraform (0.12 and later) and OpenTofu
+// print when a saved plan no longer matches the state
+var stalePlanMessages = []string{
+	"Saved plan is stale",
+	"can no longer be applied because the state was changed",
+}
+
+// isStalePlan reports whether an apply failed because its saved plan is stale
+func isStalePlan(err error) bool {
+	for _, msg := range stalePlanMessages {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
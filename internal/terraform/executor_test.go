@@ -0,0 +1,38 @@
+package terraform
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsStalePlan(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string
+		want bool
+	}{
+		{
+			name: "terraform diagnostic",
+			err:  "exit status 1\n\nError: Saved plan is stale\n\nThe given plan file can no longer be applied because the state was changed\nby another operation after the plan was created.",
+			want: true,
+		},
+		{
+			name: "detail only",
+			err:  "The given plan file can no longer be applied because the state was changed by another operation",
+			want: true,
+		},
+		{
+			name: "other failure",
+			err:  "exit status 1\n\nError: Error acquiring the state lock",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStalePlan(errors.New(tt.err)); got != tt.want {
+				t.Errorf("isStalePlan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package terraform
+
+import "context"
+
+// lockFile is a no-op where flock is not available, installs are then only
+// deduplicated within the process
+func lockFile(ctx context.Context, path string) (func(), error) {
+	return func() {}, nil
+}
+
+// lockFileShared is a no-op where flock is not available
+func lockFileShared(ctx context.Context, path string) (func(), error) {
+	return func() {}, nil
+}
+
+// tryLockFile always succeeds where flock is not available
+func tryLockFile(ctx context.Context, path string) (func(), bool, error) {
+	return func() {}, true, nil
+}
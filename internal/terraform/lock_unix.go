@@ -0,0 +1,84 @@
+//go:build unix
+
+package terraform
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// lockFile takes an exclusive lock on path shared with other executor
+// processes using the same cache, waiting until it is free or ctx is done
+func lockFile(ctx context.Context, path string) (func(), error) {
+	unlock, _, err := flock(ctx, path, syscall.LOCK_EX, true)
+	return unlock, err
+}
+
+// lockFileShared takes a shared lock on path, held by jobs while they run a
+// cached binary so that it is not evicted under them
+func lockFileShared(ctx context.Context, path string) (func(), error) {
+	unlock, _, err := flock(ctx, path, syscall.LOCK_SH, true)
+	return unlock, err
+}
+
+// tryLockFile takes an exclusive lock on path without waiting, reporting
+// false when it is held by someone else
+func tryLockFile(ctx context.Context, path string) (func(), bool, error) {
+	return flock(ctx, path, syscall.LOCK_EX, false)
+}
+
+func flock(ctx context.Context, path string, how int, wait bool) (func(), bool, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, false, err
+		}
+
+		for {
+			err = syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, syscall.EWOULDBLOCK) {
+				f.Close()
+				return nil, false, err
+			}
+			if !wait {
+				f.Close()
+				return nil, false, nil
+			}
+
+			select {
+			case <-ctx.Done():
+				f.Close()
+				return nil, false, ctx.Err()
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+
+		// The lock file is removed when its version is evicted, a lock taken
+		// on a removed file does not protect anything and is retried
+		if sameFile(f, path) {
+			return func() {
+				syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+				f.Close()
+			}, true, nil
+		}
+		f.Close()
+	}
+}
+
+func sameFile(f *os.File, path string) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
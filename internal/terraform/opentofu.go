@@ -0,0 +1,173 @@
+package terraform
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/hashicorp/go-version"
+)
+
+const tofuReleasesURL = "https://github.com/opentofu/opentofu/releases/download"
+
+// installTofu downloads an OpenTofu release into the cache after verifying the
+// SHA256SUMS signature and the archive checksum
+func (vm *VersionManager) installTofu(ctx context.Context, v *version.Version, installDir string) error {
+	ver := v.String()
+	baseURL := fmt.Sprintf("%s/v%s", tofuReleasesURL, ver)
+	sumsName := fmt.Sprintf("tofu_%s_SHA256SUMS", ver)
+	archiveName := fmt.Sprintf("tofu_%s_%s_%s.zip", ver, runtime.GOOS, runtime.GOARCH)
+
+	sums, err := download(ctx, baseURL+"/"+sumsName)
+	if err != nil {
+		return err
+	}
+	signature, err := download(ctx, baseURL+"/"+sumsName+".gpgsig")
+	if err != nil {
+		return err
+	}
+	if err := vm.verifyTofuSignature(ctx, sums, signature); err != nil {
+		return err
+	}
+
+	archive, err := download(ctx, baseURL+"/"+archiveName)
+	if err != nil {
+		return err
+	}
+	if err := verifyChecksum(sums, archiveName, archive); err != nil {
+		return err
+	}
+
+	return extractBinary(archive, string(OpenTofu), installDir)
+}
+
+// verifyTofuSignature checks the SHA256SUMS signature with the OpenTofu
+// signing key, whose fingerprint must match the configured one
+func (vm *VersionManager) verifyTofuSignature(ctx context.Context, sums, signature []byte) error {
+	var armoredKey []byte
+	var err error
+	if vm.Config.TofuGPGKeyFile != "" {
+		armoredKey, err = os.ReadFile(vm.Config.TofuGPGKeyFile)
+	} else {
+		armoredKey, err = download(ctx, vm.Config.TofuGPGKeyURL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read OpenTofu signing key: %w", err)
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armoredKey))
+	if err != nil {
+		return fmt.Errorf("failed to parse OpenTofu signing key: %w", err)
+	}
+
+	expected := strings.ToUpper(strings.ReplaceAll(vm.Config.TofuGPGKeyFingerprint, " ", ""))
+	var trusted openpgp.EntityList
+	for _, entity := range keyring {
+		if strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint)) == expected {
+			trusted = append(trusted, entity)
+		}
+	}
+	if len(trusted) == 0 {
+		return fmt.Errorf("OpenTofu signing key does not match fingerprint %s", expected)
+	}
+
+	if bytes.HasPrefix(signature, []byte("-----BEGIN")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(trusted, bytes.NewReader(sums), bytes.NewReader(signature), nil)
+	} else {
+		_, err = openpgp.CheckDetachedSignature(trusted, bytes.NewReader(sums), bytes.NewReader(signature), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid SHA256SUMS signature: %w", err)
+	}
+	return nil
+}
+
+func download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verifyChecksum checks data against its entry in a SHA256SUMS file
+func verifyChecksum(sums []byte, filename string, data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != filename {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != strings.ToLower(fields[0]) {
+			return fmt.Errorf("checksum mismatch for %s", filename)
+		}
+		return nil
+	}
+	return fmt.Errorf("no checksum found for %s", filename)
+}
+
+// extractBinary writes the named executable of a zip archive to dir
+func extractBinary(archive []byte, name, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		// Write to a temporary file first so that a partial binary is never used
+		tmp, err := os.CreateTemp(dir, name+".tmp-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+
+		if _, err := io.Copy(tmp, rc); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		if err := os.Chmod(tmp.Name(), 0755); err != nil {
+			return err
+		}
+		return os.Rename(tmp.Name(), filepath.Join(dir, name))
+	}
+	return fmt.Errorf("%s not found in archive", name)
+}
@@ -0,0 +1,65 @@
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+// ShowPlan returns the saved plan of the working directory as parsed from
+// terraform show -json, along with the JSON exactly as terraform printed it
+func (e *Executor) ShowPlan(ctx context.Context) (*tfjson.Plan, []byte, error) {
+	tf, err := e.newTerraform()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Capture the plan JSON instead of sending it to the job logs
+	var raw bytes.Buffer
+	tf.SetStdout(&raw)
+
+	plan, err := tf.ShowPlanFile(ctx, PlanFileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error running Show: %s", err)
+	}
+	return plan, raw.Bytes(), nil
+}
+
+// SummarizePlan counts the resource changes of a plan per action
+func SummarizePlan(plan *tfjson.Plan) *model.PlanSummary {
+	summary := &model.PlanSummary{
+		Resources: model.PlanSummaryResources{
+			Add:     []string{},
+			Change:  []string{},
+			Destroy: []string{},
+			Replace: []string{},
+		},
+	}
+
+	for _, rc := range plan.ResourceChanges {
+		if rc.Change == nil {
+			continue
+		}
+
+		actions := rc.Change.Actions
+		switch {
+		case actions.Replace():
+			summary.Replace++
+			summary.Resources.Replace = append(summary.Resources.Replace, rc.Address)
+		case actions.Create():
+			summary.Add++
+			summary.Resources.Add = append(summary.Resources.Add, rc.Address)
+		case actions.Update():
+			summary.Change++
+			summary.Resources.Change = append(summary.Resources.Change, rc.Address)
+		case actions.Delete():
+			summary.Destroy++
+			summary.Resources.Destroy = append(summary.Resources.Destroy, rc.Address)
+		}
+	}
+
+	return summary
+}
@@ -0,0 +1,101 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+func TestSummarizePlan(t *testing.T) {
+	change := func(address string, actions ...tfjson.Action) *tfjson.ResourceChange {
+		return &tfjson.ResourceChange{Address: address, Change: &tfjson.Change{Actions: actions}}
+	}
+
+	tests := []struct {
+		name    string
+		changes []*tfjson.ResourceChange
+		want    model.PlanSummaryResources
+	}{
+		{
+			name:    "empty plan",
+			changes: nil,
+		},
+		{
+			name:    "create",
+			changes: []*tfjson.ResourceChange{change("aws_s3_bucket.logs", tfjson.ActionCreate)},
+			want:    model.PlanSummaryResources{Add: []string{"aws_s3_bucket.logs"}},
+		},
+		{
+			name:    "update",
+			changes: []*tfjson.ResourceChange{change("aws_s3_bucket.logs", tfjson.ActionUpdate)},
+			want:    model.PlanSummaryResources{Change: []string{"aws_s3_bucket.logs"}},
+		},
+		{
+			name:    "delete",
+			changes: []*tfjson.ResourceChange{change("aws_s3_bucket.logs", tfjson.ActionDelete)},
+			want:    model.PlanSummaryResources{Destroy: []string{"aws_s3_bucket.logs"}},
+		},
+		{
+			name:    "create before destroy replace",
+			changes: []*tfjson.ResourceChange{change("aws_instance.web", tfjson.ActionCreate, tfjson.ActionDelete)},
+			want:    model.PlanSummaryResources{Replace: []string{"aws_instance.web"}},
+		},
+		{
+			name:    "delete before create replace",
+			changes: []*tfjson.ResourceChange{change("aws_instance.web", tfjson.ActionDelete, tfjson.ActionCreate)},
+			want:    model.PlanSummaryResources{Replace: []string{"aws_instance.web"}},
+		},
+		{
+			name:    "no-op",
+			changes: []*tfjson.ResourceChange{change("aws_instance.web", tfjson.ActionNoop)},
+		},
+		{
+			name:    "read",
+			changes: []*tfjson.ResourceChange{change("data.aws_ami.ubuntu", tfjson.ActionRead)},
+		},
+		{
+			name:    "missing change",
+			changes: []*tfjson.ResourceChange{{Address: "aws_instance.web"}},
+		},
+		{
+			name: "mixed",
+			changes: []*tfjson.ResourceChange{
+				change("aws_instance.a", tfjson.ActionCreate),
+				change("data.aws_ami.ubuntu", tfjson.ActionRead),
+				change("aws_instance.b", tfjson.ActionDelete, tfjson.ActionCreate),
+				change("aws_instance.c", tfjson.ActionCreate),
+				change("aws_instance.d", tfjson.ActionNoop),
+				change("aws_instance.e", tfjson.ActionUpdate),
+			},
+			want: model.PlanSummaryResources{
+				Add:     []string{"aws_instance.a", "aws_instance.c"},
+				Change:  []string{"aws_instance.e"},
+				Replace: []string{"aws_instance.b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SummarizePlan(&tfjson.Plan{ResourceChanges: tt.changes})
+
+			want := model.PlanSummary{
+				Add:     len(tt.want.Add),
+				Change:  len(tt.want.Change),
+				Destroy: len(tt.want.Destroy),
+				Replace: len(tt.want.Replace),
+				Resources: model.PlanSummaryResources{
+					Add:     append([]string{}, tt.want.Add...),
+					Change:  append([]string{}, tt.want.Change...),
+					Destroy: append([]string{}, tt.want.Destroy...),
+					Replace: append([]string{}, tt.want.Replace...),
+				},
+			}
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("got %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package terraform
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ilkerispir/terrakube-executor/internal/config"
+	"github.com/ilkerispir/terrakube-executor/internal/storage"
+)
+
+// pluginCacheLock is the lock file serializing writes to the plugin cache
+const pluginCacheLock = ".lock"
+
+// PluginCache is a provider plugin cache shared by the jobs of the executor.
+// With a storage key it can be restored from and persisted to the storage
+// backend, for batch pods that start empty.
+//
+// Terraform does not support concurrent writes to TF_PLUGIN_CACHE_DIR, so each
+// init is given a cache of its own linking to the shared packages. The packages
+// it downloads are then published to the shared cache, complete packages being
+// renamed into place under the lock. Entries of the cache directory starting
+// with a dot are not part of the cache.
+type PluginCache struct {
+	Dir        string
+	Storage    storage.StorageService
+	StorageKey string
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewPluginCache returns the plugin cache of the executor, nil if it is disabled
+func NewPluginCache(cfg *config.Config, storage storage.StorageService) *PluginCache {
+	if !cfg.PluginCacheEnabled {
+		return nil
+	}
+
+	dir := cfg.PluginCacheDir
+	if dir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			log.Printf("Failed to get user home dir, using /tmp: %v", err)
+			homeDir = "/tmp"
+		}
+		dir = filepath.Join(homeDir, ".terrakube", "plugin-cache")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Failed to create plugin cache dir, disabling the plugin cache: %v", err)
+		return nil
+	}
+
+	return &PluginCache{
+		Dir:        dir,
+		Storage:    storage,
+		StorageKey: cfg.PluginCacheStorageKey,
+	}
+}
+
+// Stats returns how many provider packages were found in or added to the cache
+func (c *PluginCache) Stats() (hits, misses int64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// Run runs fn, usually terraform init in workingDir, with a plugin cache
+// directory of the job linking to the shared cache. It then publishes the
+// downloaded providers and records which providers came from the cache. The
+// directory of the job is kept in workingDir, as terraform links to it.
+func (c *PluginCache) Run(ctx context.Context, workingDir string, fn func(ctx context.Context, cacheDir string) error) error {
+	jobDir := filepath.Join(workingDir, ".terraform", "plugin-cache")
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		return fmt.Errorf("failed to create plugin cache dir: %w", err)
+	}
+	cached := providerPackages(c.Dir)
+	for pkg := range cached {
+		if err := linkPackage(filepath.Join(c.Dir, pkg), filepath.Join(jobDir, pkg)); err != nil {
+			log.Printf("Failed to link cached provider %s: %v", pkg, err)
+		}
+	}
+
+	if err := fn(ctx, jobDir); err != nil {
+		return err
+	}
+
+	var downloaded []string
+	for pkg := range providerPackages(jobDir) {
+		if !cached[pkg] {
+			downloaded = append(downloaded, pkg)
+		}
+	}
+	if len(downloaded) > 0 {
+		if err := c.publish(ctx, jobDir, downloaded); err != nil {
+			log.Printf("Failed to add providers to the plugin cache: %v", err)
+		}
+	}
+
+	var hits, misses int64
+	for pkg := range providerPackages(filepath.Join(workingDir, ".terraform", "providers")) {
+		if cached[pkg] {
+			hits++
+		} else {
+			misses++
+		}
+	}
+	c.hits.Add(hits)
+	c.misses.Add(misses)
+
+	log.Printf("Plugin cache: %d providers from cache, %d downloaded", hits, misses)
+	return nil
+}
+
+// publish copies the packages downloaded in jobDir into the shared cache
+func (c *PluginCache) publish(ctx context.Context, jobDir string, packages []string) error {
+	unlock, err := lockFile(ctx, filepath.Join(c.Dir, pluginCacheLock))
+	if err != nil {
+		return fmt.Errorf("failed to lock plugin cache: %w", err)
+	}
+	defer unlock()
+
+	for _, pkg := range packages {
+		target := filepath.Join(c.Dir, filepath.FromSlash(pkg))
+		if _, err := os.Stat(target); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		tmp, err := os.MkdirTemp(c.Dir, ".publish-")
+		if err != nil {
+			return err
+		}
+		err = copyDir(filepath.Join(jobDir, filepath.FromSlash(pkg)), tmp)
+		if err == nil {
+			err = os.Rename(tmp, target)
+		}
+		if err != nil {
+			os.RemoveAll(tmp)
+			return fmt.Errorf("failed to publish %s: %w", pkg, err)
+		}
+	}
+	return nil
+}
+
+// linkPackage links a package of the shared cache into the cache of a job
+func linkPackage(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(src, dst)
+}
+
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// providerPackages lists the provider packages of a plugin directory, laid out
+// as <hostname>/<namespace>/<type>/<version>/<os>_<arch>. Packages may be
+// directories or links to them.
+func providerPackages(dir string) map[string]bool {
+	packages := make(map[string]bool)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		if strings.HasPrefix(rel, ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.Count(rel, string(filepath.Separator)) == 4 {
+			packages[filepath.ToSlash(rel)] = true
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return packages
+}
+
+// Restore extracts the cache persisted in the storage backend, if any
+func (c *PluginCache) Restore() error {
+	if c.StorageKey == "" {
+		return nil
+	}
+
+	rc, err := c.Storage.DownloadFile(c.StorageKey)
+	if err != nil || rc == nil {
+		log.Printf("No persisted plugin cache found at %s", c.StorageKey)
+		return nil
+	}
+	defer rc.Close()
+
+	unlock, err := lockFile(context.Background(), filepath.Join(c.Dir, pluginCacheLock))
+	if err != nil {
+		return fmt.Errorf("failed to lock plugin cache: %w", err)
+	}
+	defer unlock()
+
+	if err := extractTarGz(rc, c.Dir); err != nil {
+		return fmt.Errorf("failed to restore plugin cache: %w", err)
+	}
+	log.Printf("Restored plugin cache from %s", c.StorageKey)
+	return nil
+}
+
+// Persist uploads the cache to the storage backend when providers were
+// downloaded since the executor started
+func (c *PluginCache) Persist() error {
+	if c.StorageKey == "" || c.misses.Load() == 0 {
+		return nil
+	}
+
+	unlock, err := lockFile(context.Background(), filepath.Join(c.Dir, pluginCacheLock))
+	if err != nil {
+		return fmt.Errorf("failed to lock plugin cache: %w", err)
+	}
+	defer unlock()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTarGz(pw, c.Dir))
+	}()
+
+	if err := c.Storage.UploadFile(c.StorageKey, pr); err != nil {
+		pr.CloseWithError(err)
+		return fmt.Errorf("failed to persist plugin cache: %w", err)
+	}
+	log.Printf("Persisted plugin cache to %s", c.StorageKey)
+	return nil
+}
+
+func writeTarGz(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if strings.HasPrefix(rel, ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func extractTarGz(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path in archive: %s", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
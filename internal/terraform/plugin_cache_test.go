@@ -0,0 +1,73 @@
+//go:build unix
+
+package terraform
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPluginCacheRun(t *testing.T) {
+	cache := &PluginCache{Dir: t.TempDir()}
+	const aws = "registry.terraform.io/hashicorp/aws/5.0.0/linux_amd64"
+	const random = "registry.terraform.io/hashicorp/random/3.6.0/linux_amd64"
+
+	// init stands in for terraform init, installing the providers from the
+	// cache when they are there and downloading them into it otherwise
+	init := func(providers ...string) func(ctx context.Context, cacheDir string) error {
+		return func(ctx context.Context, cacheDir string) error {
+			workingDir := filepath.Dir(filepath.Dir(cacheDir))
+			for _, pkg := range providers {
+				cached := filepath.Join(cacheDir, filepath.FromSlash(pkg))
+				if _, err := os.Stat(cached); err != nil {
+					if err := os.MkdirAll(cached, 0755); err != nil {
+						return err
+					}
+					if err := os.WriteFile(filepath.Join(cached, "provider"), []byte(pkg), 0755); err != nil {
+						return err
+					}
+				}
+				installed := filepath.Join(workingDir, ".terraform", "providers", filepath.FromSlash(pkg))
+				if err := os.MkdirAll(filepath.Dir(installed), 0755); err != nil {
+					return err
+				}
+				if err := os.Symlink(cached, installed); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	tests := []struct {
+		name       string
+		providers  []string
+		wantHits   int64
+		wantMisses int64
+	}{
+		{"empty cache", []string{aws}, 0, 1},
+		{"cached", []string{aws}, 1, 1},
+		{"partially cached", []string{aws, random}, 2, 2},
+	}
+
+	for _, tt := range tests {
+		if err := cache.Run(context.Background(), t.TempDir(), init(tt.providers...)); err != nil {
+			t.Fatalf("%s: Run() error = %v", tt.name, err)
+		}
+		if hits, misses := cache.Stats(); hits != tt.wantHits || misses != tt.wantMisses {
+			t.Errorf("%s: Stats() = %d, %d, want %d, %d", tt.name, hits, misses, tt.wantHits, tt.wantMisses)
+		}
+		for _, pkg := range tt.providers {
+			content, err := os.ReadFile(filepath.Join(cache.Dir, filepath.FromSlash(pkg), "provider"))
+			if err != nil || string(content) != pkg {
+				t.Errorf("%s: %s not published to the shared cache: %v", tt.name, pkg, err)
+			}
+		}
+	}
+
+	if got := len(providerPackages(cache.Dir)); got != 2 {
+		t.Errorf("shared cache holds %d packages, want 2", got)
+	}
+}
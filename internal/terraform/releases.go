@@ -0,0 +1,208 @@
+package terraform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-version"
+)
+
+// releaseIndexURLs lists the published releases of each tool
+var releaseIndexURLs = map[Tool]string{
+	Terraform: "https://releases.hashicorp.com/terraform/index.json",
+	OpenTofu:  "https://get.opentofu.org/tofu/api.json",
+}
+
+// versionFiles are read, in order, from the working directory when a job does not set a version
+var versionFiles = map[Tool][]string{
+	Terraform: {".terraform-version"},
+	OpenTofu:  {".opentofu-version", ".terraform-version"},
+}
+
+var requiredVersionPattern = regexp.MustCompile(`required_version\s*=\s*"([^"]+)"`)
+
+// DetectVersion returns the version requested by the configuration in
+// workingDir, from a version file or the required_version setting
+func DetectVersion(tool Tool, workingDir string) (string, error) {
+	for _, name := range versionFiles[tool] {
+		content, err := os.ReadFile(filepath.Join(workingDir, name))
+		if err == nil && strings.TrimSpace(string(content)) != "" {
+			return strings.TrimSpace(string(content)), nil
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(workingDir, "*.tf"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		if match := requiredVersionPattern.FindSubmatch(content); match != nil {
+			return string(match[1]), nil
+		}
+	}
+
+	return "", fmt.Errorf("no %s version set in the job, a version file or required_version", tool)
+}
+
+// Resolve turns an exact version, a constraint such as "~> 1.6" or ">= 1.5, < 1.8",
+// or "latest" into the newest matching released version
+func (vm *VersionManager) Resolve(ctx context.Context, tool Tool, spec string) (string, error) {
+	spec = strings.TrimSpace(spec)
+	if v, err := version.NewVersion(spec); err == nil {
+		return v.String(), nil
+	}
+
+	var constraints version.Constraints
+	if spec != "latest" {
+		var err error
+		constraints, err = version.NewConstraint(spec)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s version constraint %s: %w", tool, spec, err)
+		}
+	}
+
+	versions, err := vm.releasedVersions(ctx, tool)
+	if err != nil {
+		return "", err
+	}
+
+	// versions are sorted newest first
+	for _, v := range versions {
+		if constraints == nil && v.Prerelease() != "" {
+			continue
+		}
+		if constraints == nil || constraints.Check(v) {
+			log.Printf("Resolved %s version %s to %s", tool, spec, v)
+			return v.String(), nil
+		}
+	}
+	return "", fmt.Errorf("no %s release matches %s", tool, spec)
+}
+
+// releasedVersions reads the release index, from the cache when it is fresh
+// or the executor is offline and falling back to a stale cache when the index
+// cannot be fetched
+func (vm *VersionManager) releasedVersions(ctx context.Context, tool Tool) ([]*version.Version, error) {
+	cachePath := filepath.Join(vm.CacheDir, "index", string(tool)+".json")
+
+	info, statErr := os.Stat(cachePath)
+	fresh := statErr == nil && time.Since(info.ModTime()) < vm.Config.VersionIndexTTL
+	if vm.Config.VersionIndexOffline || fresh {
+		return readIndexCache(cachePath)
+	}
+
+	versions, err := fetchReleaseIndex(ctx, tool)
+	if err != nil {
+		if statErr == nil {
+			log.Printf("Failed to fetch %s release index, using cached index: %v", tool, err)
+			return readIndexCache(cachePath)
+		}
+		return nil, err
+	}
+
+	if err := writeIndexCache(cachePath, versions); err != nil {
+		log.Printf("Failed to cache %s release index: %v", tool, err)
+	}
+	return versions, nil
+}
+
+func fetchReleaseIndex(ctx context.Context, tool Tool) ([]*version.Version, error) {
+	content, err := download(ctx, releaseIndexURLs[tool])
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s release index: %w", tool, err)
+	}
+
+	var ids []string
+	switch tool {
+	case Terraform:
+		var index struct {
+			Versions map[string]json.RawMessage `json:"versions"`
+		}
+		if err := json.Unmarshal(content, &index); err != nil {
+			return nil, fmt.Errorf("failed to parse %s release index: %w", tool, err)
+		}
+		for id := range index.Versions {
+			ids = append(ids, id)
+		}
+	case OpenTofu:
+		var index struct {
+			Versions []struct {
+				Id string `json:"id"`
+			} `json:"versions"`
+		}
+		if err := json.Unmarshal(content, &index); err != nil {
+			return nil, fmt.Errorf("failed to parse %s release index: %w", tool, err)
+		}
+		for _, v := range index.Versions {
+			ids = append(ids, v.Id)
+		}
+	}
+
+	return parseVersions(ids), nil
+}
+
+// parseVersions parses and sorts versions newest first, skipping invalid ones
+func parseVersions(ids []string) []*version.Version {
+	versions := make([]*version.Version, 0, len(ids))
+	for _, id := range ids {
+		if v, err := version.NewVersion(id); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	sort.Sort(sort.Reverse(version.Collection(versions)))
+	return versions
+}
+
+func readIndexCache(path string) ([]*version.Version, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached release index: %w", err)
+	}
+	var ids []string
+	if err := json.Unmarshal(content, &ids); err != nil {
+		return nil, fmt.Errorf("failed to parse cached release index: %w", err)
+	}
+	return parseVersions(ids), nil
+}
+
+func writeIndexCache(path string, versions []*version.Version) error {
+	ids := make([]string, len(versions))
+	for i, v := range versions {
+		ids[i] = v.String()
+	}
+	content, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
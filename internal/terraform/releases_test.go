@@ -0,0 +1,199 @@
+package terraform
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ilkerispir/terrakube-executor/internal/config"
+)
+
+var indexVersions = []string{"1.5.7", "1.6.0", "1.6.6", "1.7.0-rc1", "1.7.5", "1.8.0-beta1"}
+
+// offlineVersionManager resolves versions from a cached index only
+func offlineVersionManager(t *testing.T, tool Tool, ids []string) *VersionManager {
+	t.Helper()
+	vm := &VersionManager{
+		CacheDir: t.TempDir(),
+		Config:   &config.Config{VersionIndexOffline: true},
+	}
+	if ids != nil {
+		path := filepath.Join(vm.CacheDir, "index", string(tool)+".json")
+		if err := writeIndexCache(path, parseVersions(ids)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return vm
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "1.4.2", want: "1.4.2"},
+		{spec: " 1.6.0 ", want: "1.6.0"},
+		{spec: "1.8.0-beta1", want: "1.8.0-beta1"},
+		{spec: "~> 1.6.0", want: "1.6.6"},
+		{spec: "~> 1.6", want: "1.7.5"},
+		{spec: ">= 1.5, < 1.7", want: "1.6.6"},
+		{spec: "< 1.6", want: "1.5.7"},
+		{spec: "latest", want: "1.7.5"},
+		{spec: "> 2.0", wantErr: true},
+		{spec: "one point six", wantErr: true},
+	}
+
+	vm := offlineVersionManager(t, Terraform, indexVersions)
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := vm.Resolve(context.Background(), Terraform, tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveOfflineWithoutCache(t *testing.T) {
+	vm := offlineVersionManager(t, OpenTofu, nil)
+	if _, err := vm.Resolve(context.Background(), OpenTofu, "latest"); err == nil {
+		t.Fatal("expected an error without a cached index")
+	}
+	// Exact versions never need the index
+	if got, err := vm.Resolve(context.Background(), OpenTofu, "1.6.2"); err != nil || got != "1.6.2" {
+		t.Errorf("Resolve() = %q, %v", got, err)
+	}
+}
+
+func TestReleasedVersionsCache(t *testing.T) {
+	var fetches atomic.Int32
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if fail.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"name":"terraform","versions":{"1.6.0":{},"1.7.5":{},"1.8.0-rc1":{}}}`))
+	}))
+	defer srv.Close()
+
+	saved := releaseIndexURLs[Terraform]
+	releaseIndexURLs[Terraform] = srv.URL
+	defer func() { releaseIndexURLs[Terraform] = saved }()
+
+	vm := &VersionManager{CacheDir: t.TempDir(), Config: &config.Config{VersionIndexTTL: time.Hour}}
+	ctx := context.Background()
+
+	if got, err := vm.Resolve(ctx, Terraform, "latest"); err != nil || got != "1.7.5" {
+		t.Fatalf("Resolve() = %q, %v", got, err)
+	}
+	// A fresh cache answers without fetching the index again
+	if got, err := vm.Resolve(ctx, Terraform, "~> 1.6.0"); err != nil || got != "1.6.0" {
+		t.Fatalf("Resolve() = %q, %v", got, err)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched the index %d times, want 1", n)
+	}
+
+	// A stale cache is refreshed, and used as is when the index is unavailable
+	cachePath := filepath.Join(vm.CacheDir, "index", string(Terraform)+".json")
+	stale := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(cachePath, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	fail.Store(true)
+	if got, err := vm.Resolve(ctx, Terraform, "latest"); err != nil || got != "1.7.5" {
+		t.Fatalf("Resolve() with a stale cache = %q, %v", got, err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetched the index %d times, want 2", n)
+	}
+}
+
+func TestDetectVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		tool    Tool
+		files   map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "terraform version file",
+			tool:  Terraform,
+			files: map[string]string{".terraform-version": "1.6.6\n", "main.tf": `terraform { required_version = "~> 1.5" }`},
+			want:  "1.6.6",
+		},
+		{
+			name:  "required_version",
+			tool:  Terraform,
+			files: map[string]string{"main.tf": "terraform {\n  required_version = \">= 1.5, < 1.8\"\n}\n"},
+			want:  ">= 1.5, < 1.8",
+		},
+		{
+			name:  "empty version file falls back to required_version",
+			tool:  Terraform,
+			files: map[string]string{".terraform-version": "\n", "versions.tf": `terraform { required_version = "1.7.0" }`},
+			want:  "1.7.0",
+		},
+		{
+			name:  "first file in name order",
+			tool:  Terraform,
+			files: map[string]string{"b.tf": `terraform { required_version = "1.6.0" }`, "a.tf": `terraform { required_version = "1.5.0" }`},
+			want:  "1.5.0",
+		},
+		{
+			name:  "opentofu version file first",
+			tool:  OpenTofu,
+			files: map[string]string{".opentofu-version": "1.7.1", ".terraform-version": "1.6.6"},
+			want:  "1.7.1",
+		},
+		{
+			name:  "opentofu falls back to the terraform version file",
+			tool:  OpenTofu,
+			files: map[string]string{".terraform-version": "1.6.6"},
+			want:  "1.6.6",
+		},
+		{
+			name:  "terraform ignores the opentofu version file",
+			tool:  Terraform,
+			files: map[string]string{".opentofu-version": "1.7.1", "main.tf": `terraform { required_version = "1.5.7" }`},
+			want:  "1.5.7",
+		},
+		{
+			name:    "no version",
+			tool:    Terraform,
+			files:   map[string]string{"main.tf": `resource "null_resource" "x" {}`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := DetectVersion(tt.tool, dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DetectVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DetectVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
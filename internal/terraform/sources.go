@@ -0,0 +1,126 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hc-install/product"
+	"github.com/hashicorp/hc-install/releases"
+	"github.com/ilkerispir/terrakube-executor/internal/storage"
+)
+
+// Install sources, tried in the configured order
+const (
+	SourceLocal    = "local"
+	SourceMirror   = "mirror"
+	SourceStorage  = "storage"
+	SourceReleases = "releases"
+)
+
+// fileSource reads release files laid out like releases.hashicorp.com:
+// <tool>/<version>/<tool>_<version>_<os>_<arch>.zip and <tool>/<version>/<tool>_<version>_SHA256SUMS
+type fileSource interface {
+	fetch(ctx context.Context, name string) ([]byte, error)
+}
+
+type localSource struct {
+	dir string
+}
+
+func (s localSource) fetch(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(name)))
+}
+
+type mirrorSource struct {
+	baseURL string
+}
+
+func (s mirrorSource) fetch(ctx context.Context, name string) ([]byte, error) {
+	return download(ctx, strings.TrimSuffix(s.baseURL, "/")+"/"+name)
+}
+
+type storageSource struct {
+	storage storage.StorageService
+	prefix  string
+}
+
+func (s storageSource) fetch(ctx context.Context, name string) ([]byte, error) {
+	rc, err := s.storage.DownloadFile(path.Join(s.prefix, name))
+	if err != nil {
+		return nil, err
+	}
+	if rc == nil {
+		return nil, fmt.Errorf("%s not found in storage", name)
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// sourceByName returns the configured source with the given name, nil when it is not configured
+func (vm *VersionManager) sourceByName(name string) fileSource {
+	switch name {
+	case SourceLocal:
+		if vm.Config.BinaryLocalDir != "" {
+			return localSource{dir: vm.Config.BinaryLocalDir}
+		}
+	case SourceMirror:
+		if vm.Config.BinaryMirrorURL != "" {
+			return mirrorSource{baseURL: vm.Config.BinaryMirrorURL}
+		}
+	case SourceStorage:
+		if vm.Config.BinaryStoragePrefix != "" && vm.Storage != nil {
+			return storageSource{storage: vm.Storage, prefix: vm.Config.BinaryStoragePrefix}
+		}
+	}
+	return nil
+}
+
+// installFromSource downloads the release archive and SHA256SUMS from a file
+// source, verifies the checksum and extracts the binary into installDir
+func installFromSource(ctx context.Context, source fileSource, tool Tool, v *version.Version, installDir string) error {
+	ver := v.String()
+	dir := fmt.Sprintf("%s/%s", tool, ver)
+	sumsName := fmt.Sprintf("%s_%s_SHA256SUMS", tool, ver)
+	archiveName := fmt.Sprintf("%s_%s_%s_%s.zip", tool, ver, runtime.GOOS, runtime.GOARCH)
+
+	sums, err := source.fetch(ctx, dir+"/"+sumsName)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", sumsName, err)
+	}
+	archive, err := source.fetch(ctx, dir+"/"+archiveName)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", archiveName, err)
+	}
+	if err := verifyChecksum(sums, archiveName, archive); err != nil {
+		return err
+	}
+	return extractBinary(archive, string(tool), installDir)
+}
+
+// installFromReleases installs from the official releases, verifying their signatures
+func (vm *VersionManager) installFromReleases(ctx context.Context, tool Tool, v *version.Version, installDir string) error {
+	switch tool {
+	case Terraform:
+		installer := &releases.ExactVersion{
+			Product:    product.Terraform,
+			Version:    v,
+			InstallDir: installDir,
+		}
+		if err := os.MkdirAll(installDir, 0755); err != nil {
+			return err
+		}
+		_, err := installer.Install(ctx)
+		return err
+	case OpenTofu:
+		return vm.installTofu(ctx, v, installDir)
+	default:
+		return fmt.Errorf("unknown tool %s", tool)
+	}
+}
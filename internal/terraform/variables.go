@@ -0,0 +1,94 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+const (
+	// VariablesFileName is the tfvars file generated with the string and JSON
+	// job variables, loaded automatically by terraform. Its values are taken
+	// literally, template sequences such as ${ are not interpolated.
+	VariablesFileName = "terrakube.auto.tfvars.json"
+	// HCLVariablesFileName is the tfvars file generated with the HCL job
+	// variables, whose values are HCL expressions by definition
+	HCLVariablesFileName = "terrakube.auto.tfvars"
+)
+
+// variableName matches the identifiers terraform accepts as variable names
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// GenerateVariablesFile writes the job variables to tfvars files so that list,
+// map and object values keep their type
+func GenerateVariablesFile(workingDir string, variables map[string]model.Variable) error {
+	if len(variables) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		if !variableName.MatchString(name) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make(map[string]json.RawMessage)
+	var hcl strings.Builder
+	for _, name := range names {
+		v := variables[name]
+		if v.Type == model.VariableTypeHCL {
+			fmt.Fprintf(&hcl, "%s = %s\n", name, hclValue(v))
+			continue
+		}
+
+		value, err := jsonValue(v)
+		if err != nil {
+			return fmt.Errorf("invalid value for variable %s: %w", name, err)
+		}
+		values[name] = value
+	}
+
+	if len(values) > 0 {
+		content, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal variables: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(workingDir, VariablesFileName), content, 0600); err != nil {
+			return err
+		}
+	}
+	if hcl.Len() > 0 {
+		return os.WriteFile(filepath.Join(workingDir, HCLVariablesFileName), []byte(hcl.String()), 0600)
+	}
+	return nil
+}
+
+func hclValue(v model.Variable) string {
+	if strings.TrimSpace(v.Value) == "" {
+		return "null"
+	}
+	return v.Value
+}
+
+func jsonValue(v model.Variable) (json.RawMessage, error) {
+	switch v.Type {
+	case model.VariableTypeJSON:
+		if !json.Valid([]byte(v.Value)) {
+			return nil, fmt.Errorf("value is not valid JSON")
+		}
+		return json.RawMessage(v.Value), nil
+	case model.VariableTypeString, "":
+		return json.Marshal(v.Value)
+	default:
+		return nil, fmt.Errorf("unknown variable type %q", v.Type)
+	}
+}
@@ -0,0 +1,106 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+func TestGenerateVariablesFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables map[string]model.Variable
+		wantJSON  string
+		wantHCL   string
+		wantErr   bool
+	}{
+		{
+			name: "string",
+			variables: map[string]model.Variable{
+				"region": {Value: "eu-west-1", Type: model.VariableTypeString},
+			},
+			wantJSON: "{\n  \"region\": \"eu-west-1\"\n}",
+		},
+		{
+			name: "string with template sequences",
+			variables: map[string]model.Variable{
+				"greeting": {Value: "${file(\"/etc/passwd\")} %{if true}x%{endif}"},
+			},
+			wantJSON: "{\n  \"greeting\": \"${file(\\\"/etc/passwd\\\")} %{if true}x%{endif}\"\n}",
+		},
+		{
+			name: "json",
+			variables: map[string]model.Variable{
+				"tags": {Value: `{"team": "${var.x}"}`, Type: model.VariableTypeJSON},
+			},
+			wantJSON: "{\n  \"tags\": {\n    \"team\": \"${var.x}\"\n  }\n}",
+		},
+		{
+			name: "invalid json",
+			variables: map[string]model.Variable{
+				"tags": {Value: `{"team": `, Type: model.VariableTypeJSON},
+			},
+			wantErr: true,
+		},
+		{
+			name: "hcl",
+			variables: map[string]model.Variable{
+				"subnets": {Value: `["10.0.1.0/24"]`, Type: model.VariableTypeHCL},
+				"empty":   {Value: " ", Type: model.VariableTypeHCL},
+			},
+			wantHCL: "empty = null\nsubnets = [\"10.0.1.0/24\"]\n",
+		},
+		{
+			name: "unknown type",
+			variables: map[string]model.Variable{
+				"x": {Value: "1", Type: "yaml"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid name",
+			variables: map[string]model.Variable{
+				"x = 1\ny": {Value: "1"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "name starting with a digit",
+			variables: map[string]model.Variable{
+				"1x": {Value: "1"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := GenerateVariablesFile(dir, tt.variables)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateVariablesFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := readFile(t, filepath.Join(dir, VariablesFileName)); got != tt.wantJSON {
+				t.Errorf("%s = %q, want %q", VariablesFileName, got, tt.wantJSON)
+			}
+			if got := readFile(t, filepath.Join(dir, HCLVariablesFileName)); got != tt.wantHCL {
+				t.Errorf("%s = %q, want %q", HCLVariablesFileName, got, tt.wantHCL)
+			}
+		})
+	}
+}
+
+// readFile returns the content of path, empty when it does not exist
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
@@ -2,21 +2,36 @@ package terraform
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
 	"github.com/hashicorp/go-version"
-	"github.com/hashicorp/hc-install/product"
-	"github.com/hashicorp/hc-install/releases"
+	"github.com/ilkerispir/terrakube-executor/internal/config"
+	"github.com/ilkerispir/terrakube-executor/internal/storage"
+	"golang.org/x/sync/singleflight"
+)
+
+// Tool is the infrastructure as code CLI run by a job
+type Tool string
+
+const (
+	Terraform Tool = "terraform"
+	OpenTofu  Tool = "tofu"
 )
 
 type VersionManager struct {
 	CacheDir string
+	Config   *config.Config
+	Storage  storage.StorageService
+
+	// installs deduplicates concurrent installs of the same version
+	installs singleflight.Group
 }
 
-func NewVersionManager() *VersionManager {
+func NewVersionManager(cfg *config.Config, storage storage.StorageService) *VersionManager {
 	// Use a dedicated directory for terraform binaries
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -29,33 +44,181 @@ func NewVersionManager() *VersionManager {
 		log.Printf("Failed to create cache dir: %v", err)
 	}
 
+	// Binaries used to be installed directly in the cache dir, where they
+	// would now shadow the per tool directories
+	for _, tool := range []Tool{Terraform, OpenTofu} {
+		legacy := filepath.Join(cacheDir, string(tool))
+		if info, err := os.Stat(legacy); err == nil && info.Mode().IsRegular() {
+			os.Remove(legacy)
+		}
+	}
+
 	return &VersionManager{
 		CacheDir: cacheDir,
+		Config:   cfg,
+		Storage:  storage,
 	}
 }
 
-func (vm *VersionManager) Install(ver string) (string, error) {
-	ctx := context.Background()
-
+// Install returns the binary of an exact version, installing it into
+// <CacheDir>/<tool>/<version> from the first configured source that has it.
+// Concurrent installs of a version share a single download, also across
+// processes using the same cache.
+//
+// The version is not evicted from the cache until the returned release
+// function is called, once the job no longer runs the binary.
+func (vm *VersionManager) Install(ctx context.Context, tool Tool, ver string) (string, func(), error) {
 	// Parse version to ensure it's valid
-	_, err := version.NewVersion(ver)
+	v, err := version.NewVersion(ver)
 	if err != nil {
-		return "", fmt.Errorf("invalid terraform version %s: %w", ver, err)
+		return "", nil, fmt.Errorf("invalid %s version %s: %w", tool, ver, err)
+	}
+
+	log.Printf("Locating %s version %s...", tool, ver)
+
+	installDir := filepath.Join(vm.CacheDir, string(tool), v.String())
+	execPath := filepath.Join(installDir, string(tool))
+
+	// A version can be evicted between its install and the lease of the job,
+	// which then installs it again
+	for attempt := 0; ; attempt++ {
+		release, err := vm.lease(ctx, installDir, execPath)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to lock %s %s: %w", tool, v, err)
+		}
+		if release != nil {
+			log.Printf("%s %s found at: %s", tool, ver, execPath)
+			return execPath, release, nil
+		}
+		if attempt == 2 {
+			return "", nil, fmt.Errorf("%s %s was evicted from the binary cache while installing it", tool, v)
+		}
+
+		// The shared install must not fail because the job that started it was
+		// cancelled, so it only stops at the install timeout
+		ch := vm.installs.DoChan(string(tool)+"@"+v.String(), func() (interface{}, error) {
+			installCtx := context.WithoutCancel(ctx)
+			if vm.Config.InstallTimeout > 0 {
+				var cancel context.CancelFunc
+				installCtx, cancel = context.WithTimeout(installCtx, vm.Config.InstallTimeout)
+				defer cancel()
+			}
+			return nil, vm.install(installCtx, tool, v, installDir)
+		})
+
+		select {
+		case res := <-ch:
+			if res.Err != nil {
+				return "", nil, res.Err
+			}
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		}
 	}
+}
 
-	log.Printf("Locating Terraform version %s...", ver)
+// lease takes a shared lock on an installed version, returning a nil release
+// function when it is not installed
+func (vm *VersionManager) lease(ctx context.Context, installDir, execPath string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(installDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %w", err)
+	}
 
-	installer := &releases.ExactVersion{
-		Product:    product.Terraform,
-		Version:    version.Must(version.NewVersion(ver)),
-		InstallDir: vm.CacheDir,
+	unlock, err := lockFileShared(ctx, installDir+".lock")
+	if err != nil {
+		return nil, err
+	}
+	if !cached(execPath) {
+		unlock()
+		return nil, nil
+	}
+	touch(installDir)
+	return unlock, nil
+}
+
+// install installs a version while holding its lock, then evicts old versions
+// if the cache grew over its limits
+func (vm *VersionManager) install(ctx context.Context, tool Tool, v *version.Version, installDir string) error {
+	if err := os.MkdirAll(filepath.Dir(installDir), 0755); err != nil {
+		return fmt.Errorf("failed to create cache dir: %w", err)
 	}
 
-	execPath, err := installer.Install(ctx)
+	unlock, err := lockFile(ctx, installDir+".lock")
 	if err != nil {
-		return "", fmt.Errorf("failed to install terraform %s: %w", ver, err)
+		return fmt.Errorf("failed to lock %s %s: %w", tool, v, err)
 	}
 
-	log.Printf("Terraform %s found at: %s", ver, execPath)
-	return execPath, nil
+	err = vm.installLocked(ctx, tool, v, installDir)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	vm.evict(ctx)
+	return nil
+}
+
+func (vm *VersionManager) installLocked(ctx context.Context, tool Tool, v *version.Version, installDir string) error {
+	execPath := filepath.Join(installDir, string(tool))
+
+	// Another process may have installed it while we waited for the lock
+	if cached(execPath) {
+		return nil
+	}
+
+	// A directory left by an install that did not complete is never trusted
+	if err := os.RemoveAll(installDir); err != nil {
+		return fmt.Errorf("failed to clean up %s: %w", installDir, err)
+	}
+
+	var errs []error
+	for _, name := range vm.Config.BinarySources {
+		var err error
+		if name == SourceReleases {
+			err = installInto(installDir, func(dir string) error {
+				return vm.installFromReleases(ctx, tool, v, dir)
+			})
+		} else if source := vm.sourceByName(name); source != nil {
+			err = installInto(installDir, func(dir string) error {
+				return installFromSource(ctx, source, tool, v, dir)
+			})
+		} else {
+			continue
+		}
+
+		if err == nil {
+			log.Printf("%s %s installed from %s at: %s", tool, v, name, execPath)
+			return nil
+		}
+		log.Printf("Failed to install %s %s from %s: %v", tool, v, name, err)
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+
+	if len(errs) == 0 {
+		return fmt.Errorf("no install source configured for %s %s", tool, v)
+	}
+	return fmt.Errorf("failed to install %s %s: %w", tool, v, errors.Join(errs...))
+}
+
+// installInto runs install in a temporary directory next to installDir and
+// renames it into place once complete, so installDir only ever holds a whole install
+func installInto(installDir string, install func(dir string) error) error {
+	tmp, err := os.MkdirTemp(filepath.Dir(installDir), "."+filepath.Base(installDir)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := install(tmp); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp, installDir)
+}
+
+func cached(execPath string) bool {
+	info, err := os.Stat(execPath)
+	return err == nil && info.Mode().IsRegular()
 }
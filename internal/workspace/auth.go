@@ -0,0 +1,99 @@
+package workspace
+
+import (
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/ilkerispir/terrakube-executor/internal/config"
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+// credentialHelper answers git credential requests from the environment so
+// that tokens never appear in the clone URL, the process arguments or git errors
+const credentialHelper = `!f() { test "$1" = get && echo "username=${TERRAKUBE_GIT_USERNAME}" && echo "password=${TERRAKUBE_GIT_PASSWORD}"; }; f`
+
+// gitAuth configures the credentials of a git command for a VCS provider
+type gitAuth interface {
+	// configure adds the credentials to cmd and returns a function removing anything it created
+	configure(cmd *exec.Cmd) (func(), error)
+}
+
+// newGitAuth selects the authentication strategy from the job's VCS type
+func newGitAuth(job *model.TerraformJob, cfg *config.Config) gitAuth {
+	if job.AccessToken == "" || job.VcsType == "PUBLIC" {
+		return noAuth{}
+	}
+
+	// For SSH connections the access token holds the private key
+	if strings.HasPrefix(job.VcsType, "SSH") {
+		return sshAuth{
+			privateKey:            job.AccessToken,
+			knownHostsFile:        cfg.SSHKnownHostsFile,
+			strictHostKeyChecking: cfg.SSHStrictHostKeyCheck,
+		}
+	}
+
+	switch job.VcsType {
+	case "GITHUB":
+		// Works for OAuth tokens, personal access tokens and GitHub App installation tokens
+		return tokenAuth{username: "x-access-token", token: job.AccessToken}
+	case "BITBUCKET":
+		return tokenAuth{username: "x-token-auth", token: job.AccessToken}
+	case "AZURE_DEVOPS":
+		// Azure DevOps ignores the username of personal access tokens but requires one
+		return tokenAuth{username: "pat", token: job.AccessToken}
+	default:
+		return tokenAuth{username: "oauth2", token: job.AccessToken}
+	}
+}
+
+type noAuth struct{}
+
+func (noAuth) configure(cmd *exec.Cmd) (func(), error) {
+	cmd.Env = append(cmd.Env, "GIT_TERMINAL_PROMPT=0")
+	return func() {}, nil
+}
+
+type tokenAuth struct {
+	username string
+	token    string
+}
+
+func (a tokenAuth) configure(cmd *exec.Cmd) (func(), error) {
+	cmd.Env = append(cmd.Env,
+		"GIT_TERMINAL_PROMPT=0",
+		// Reset any configured helper before adding ours
+		"GIT_CONFIG_COUNT=2",
+		"GIT_CONFIG_KEY_0=credential.helper",
+		"GIT_CONFIG_VALUE_0=",
+		"GIT_CONFIG_KEY_1=credential.helper",
+		"GIT_CONFIG_VALUE_1="+credentialHelper,
+		"TERRAKUBE_GIT_USERNAME="+a.username,
+		"TERRAKUBE_GIT_PASSWORD="+a.token,
+	)
+	return func() {}, nil
+}
+
+type sshAuth struct {
+	privateKey            string
+	knownHostsFile        string
+	strictHostKeyChecking string
+}
+
+func (a sshAuth) configure(cmd *exec.Cmd) (func(), error) {
+	if a.strictHostKeyChecking != "yes" {
+		log.Printf("WARNING: cloning over SSH with StrictHostKeyChecking=%s, host keys are trusted without verification on first use. Set GIT_SSH_KNOWN_HOSTS_FILE to verify them against a managed known_hosts file.", a.strictHostKeyChecking)
+	}
+
+	keyPath, err := writeSSHKey(a.privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Env = append(cmd.Env,
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_SSH_COMMAND="+sshCommand(keyPath, a.knownHostsFile, a.strictHostKeyChecking),
+	)
+	return func() { removeSSHKey(keyPath) }, nil
+}
@@ -0,0 +1,141 @@
+package workspace
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/ilkerispir/terrakube-executor/internal/config"
+	"github.com/ilkerispir/terrakube-executor/internal/model"
+)
+
+const testToken = "s3cr3t-token"
+
+// cloneCommand builds a git clone the way Setup does and configures its auth
+func cloneCommand(t *testing.T, vcsType string, cfg *config.Config) (*exec.Cmd, func()) {
+	t.Helper()
+	job := &model.TerraformJob{VcsType: vcsType, AccessToken: testToken, Source: "https://git.example.com/org/repo.git"}
+	cmd := exec.Command("git", "clone", "--depth", "1", job.Source, t.TempDir())
+
+	cleanup, err := newGitAuth(job, cfg).configure(cmd)
+	if err != nil {
+		t.Fatalf("configure() error = %v", err)
+	}
+	return cmd, cleanup
+}
+
+func envValue(env []string, name string) (string, bool) {
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == name {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func TestTokenAuth(t *testing.T) {
+	tests := []struct {
+		vcsType  string
+		username string
+	}{
+		{"GITHUB", "x-access-token"},
+		{"BITBUCKET", "x-token-auth"},
+		{"AZURE_DEVOPS", "pat"},
+		{"GITLAB", "oauth2"},
+		{"", "oauth2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.vcsType, func(t *testing.T) {
+			cmd, cleanup := cloneCommand(t, tt.vcsType, &config.Config{})
+			defer cleanup()
+
+			if got, _ := envValue(cmd.Env, "TERRAKUBE_GIT_USERNAME"); got != tt.username {
+				t.Errorf("username = %q, want %q", got, tt.username)
+			}
+			if got, _ := envValue(cmd.Env, "TERRAKUBE_GIT_PASSWORD"); got != testToken {
+				t.Errorf("password = %q, want the access token", got)
+			}
+			if got, _ := envValue(cmd.Env, "GIT_TERMINAL_PROMPT"); got != "0" {
+				t.Errorf("GIT_TERMINAL_PROMPT = %q, want 0", got)
+			}
+
+			// The token only ever travels in TERRAKUBE_GIT_PASSWORD
+			for _, arg := range cmd.Args {
+				if strings.Contains(arg, testToken) {
+					t.Errorf("argument %q holds the token", arg)
+				}
+			}
+			for _, kv := range cmd.Env {
+				if strings.Contains(kv, testToken) && !strings.HasPrefix(kv, "TERRAKUBE_GIT_PASSWORD=") {
+					t.Errorf("environment entry %q holds the token", kv)
+				}
+			}
+		})
+	}
+}
+
+func TestCredentialHelper(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	cmd, cleanup := cloneCommand(t, "GITHUB", &config.Config{})
+	defer cleanup()
+
+	// git asks the configured helper exactly like it does during a clone
+	fill := exec.Command("git", "credential", "fill")
+	fill.Env = append(os.Environ(), cmd.Env...)
+	fill.Stdin = strings.NewReader("protocol=https\nhost=git.example.com\n\n")
+	out, err := fill.Output()
+	if err != nil {
+		t.Fatalf("git credential fill: %v", err)
+	}
+	for _, want := range []string{"username=x-access-token\n", "password=" + testToken + "\n"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("credentials %q do not contain %q", out, want)
+		}
+	}
+}
+
+func TestNoAuth(t *testing.T) {
+	for _, job := range []*model.TerraformJob{
+		{VcsType: "PUBLIC", AccessToken: testToken},
+		{VcsType: "GITHUB"},
+	} {
+		auth := newGitAuth(job, &config.Config{})
+		if _, ok := auth.(noAuth); !ok {
+			t.Errorf("newGitAuth(%s, token %q) = %T, want noAuth", job.VcsType, job.AccessToken, auth)
+		}
+	}
+}
+
+func TestSSHAuth(t *testing.T) {
+	cmd, cleanup := cloneCommand(t, "SSH_RSA", &config.Config{SSHKnownHostsFile: "/etc/known_hosts", SSHStrictHostKeyCheck: "yes"})
+
+	sshCmd, _ := envValue(cmd.Env, "GIT_SSH_COMMAND")
+	if !strings.Contains(sshCmd, "StrictHostKeyChecking=yes") || !strings.Contains(sshCmd, "UserKnownHostsFile='/etc/known_hosts'") {
+		t.Errorf("GIT_SSH_COMMAND = %q", sshCmd)
+	}
+	for _, kv := range append(cmd.Args, cmd.Env...) {
+		if strings.Contains(kv, testToken) {
+			t.Errorf("%q holds the private key", kv)
+		}
+	}
+
+	// The key is written to the file passed with -i and removed by the cleanup
+	fields := strings.Fields(sshCmd)
+	keyPath := strings.Trim(fields[2], "'")
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != testToken+"\n" {
+		t.Errorf("key file holds %q", key)
+	}
+	cleanup()
+	if _, err := os.Stat(keyPath); !os.IsNotExist(err) {
+		t.Errorf("key file still exists after cleanup: %v", err)
+	}
+}
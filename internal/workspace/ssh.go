@@ -0,0 +1,66 @@
+package workspace
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// writeSSHKey stores the private key in a 0600 file outside of the clone directory
+func writeSSHKey(privateKey string) (string, error) {
+	f, err := os.CreateTemp("", "terrakube-ssh-key-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create ssh key file: %w", err)
+	}
+	defer f.Close()
+
+	if err := f.Chmod(0600); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to set ssh key permissions: %w", err)
+	}
+
+	// OpenSSH rejects keys without a trailing newline
+	if !strings.HasSuffix(privateKey, "\n") {
+		privateKey += "\n"
+	}
+	if _, err := f.WriteString(privateKey); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write ssh key file: %w", err)
+	}
+
+	return f.Name(), nil
+}
+
+// removeSSHKey overwrites the key file with zeros before deleting it
+func removeSSHKey(path string) {
+	if info, err := os.Stat(path); err == nil {
+		if f, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+			f.Write(make([]byte, info.Size()))
+			f.Sync()
+			f.Close()
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove ssh key file %s: %v", path, err)
+	}
+}
+
+// sshCommand builds the GIT_SSH_COMMAND using the given key and known_hosts policy
+func sshCommand(keyPath, knownHostsFile, strictHostKeyChecking string) string {
+	args := []string{
+		"ssh",
+		"-i", shellQuote(keyPath),
+		"-o", "IdentitiesOnly=yes",
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=" + strictHostKeyChecking,
+	}
+	if knownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+shellQuote(knownHostsFile))
+	}
+	return strings.Join(args, " ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -1,64 +1,84 @@
 package workspace
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
-	"strings"
+	"path/filepath"
 
+	"github.com/ilkerispir/terrakube-executor/internal/config"
 	"github.com/ilkerispir/terrakube-executor/internal/model"
 )
 
+// cliConfigFileName is the terraform CLI configuration of the job, kept next
+// to the clone so that it is not part of the repository
+const cliConfigFileName = "terraform.rc"
+
+// Workspace is the temporary directory of a job, holding the repository clone
+// in its source subdirectory and the job's terraform CLI configuration
 type Workspace struct {
 	Job        *model.TerraformJob
+	Config     *config.Config
 	WorkingDir string
 }
 
-func NewWorkspace(job *model.TerraformJob) *Workspace {
+func NewWorkspace(job *model.TerraformJob, cfg *config.Config) *Workspace {
 	return &Workspace{
-		Job: job,
+		Job:    job,
+		Config: cfg,
 	}
 }
 
-func (w *Workspace) Setup() (string, error) {
+func (w *Workspace) Setup(ctx context.Context) (string, error) {
 	// Create temp directory for workspace
 	tempDir, err := os.MkdirTemp("", fmt.Sprintf("terrakube-job-%s", w.Job.JobId))
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp dir: %w", err)
 	}
 	w.WorkingDir = tempDir
+	sourceDir := filepath.Join(tempDir, "source")
 
 	// Clone repository
-	repoURL := w.Job.Source
-	if w.Job.AccessToken != "" && w.Job.VcsType != "PUBLIC" {
-		if strings.HasPrefix(w.Job.Source, "https://") {
-			repoURL = strings.Replace(w.Job.Source, "https://", fmt.Sprintf("https://oauth2:%s@", w.Job.AccessToken), 1)
-		}
-	}
-
 	cmdArgs := []string{"clone", "--depth", "1"}
 	if w.Job.Branch != "" {
 		cmdArgs = append(cmdArgs, "--branch", w.Job.Branch)
 	}
-	cmdArgs = append(cmdArgs, repoURL, tempDir)
+	cmdArgs = append(cmdArgs, w.Job.Source, sourceDir)
 
-	cloneCmd := exec.Command("git", cmdArgs...)
+	cloneCmd := exec.CommandContext(ctx, "git", cmdArgs...)
 	cloneCmd.Env = os.Environ()
-	// TODO: Add SSH key support if VcsType is SSH
+
+	cleanup, err := newGitAuth(w.Job, w.Config).configure(cloneCmd)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
 
 	if output, err := cloneCmd.CombinedOutput(); err != nil {
 		return "", fmt.Errorf("git clone failed: %s: %w", string(output), err)
 	}
 
 	// Calculate final working directory (if folder is specified)
-	finalDir := tempDir
+	finalDir := sourceDir
 	if w.Job.Folder != "" {
-		finalDir = fmt.Sprintf("%s/%s", tempDir, w.Job.Folder)
+		finalDir = fmt.Sprintf("%s/%s", sourceDir, w.Job.Folder)
 	}
 
 	return finalDir, nil
 }
 
+// CLIConfigPath returns the path of the job's terraform CLI configuration
+func (w *Workspace) CLIConfigPath() string {
+	return filepath.Join(w.WorkingDir, cliConfigFileName)
+}
+
+// ScriptDir returns the directory of the job's script files, outside of the clone
+func (w *Workspace) ScriptDir() string {
+	return filepath.Join(w.WorkingDir, "scripts")
+}
+
+// Cleanup removes the workspace, including the CLI configuration and its credentials
 func (w *Workspace) Cleanup() error {
 	if w.WorkingDir != "" {
 		return os.RemoveAll(w.WorkingDir)
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/ilkerispir/terrakube-executor/internal/config"
 	"github.com/ilkerispir/terrakube-executor/internal/core"
@@ -27,17 +30,34 @@ func main() {
 	}
 	processor := core.NewJobProcessor(cfg, statusService, storageService)
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	go exitOnSecondSignal(ctx, stop)
+
 	if cfg.Mode == "BATCH" {
 		if cfg.EphemeralJobData == nil {
 			log.Fatal("Batch mode selected but no job data provided")
 		}
-		batch.AdjustAndExecute(cfg.EphemeralJobData, processor)
+		batch.AdjustAndExecute(ctx, cfg.EphemeralJobData, processor)
 	} else {
 		// Default to Online
 		port := os.Getenv("PORT")
 		if port == "" {
 			port = "8090"
 		}
-		online.StartServer(port, processor)
+		online.StartServer(ctx, port, processor)
 	}
 }
+
+// exitOnSecondSignal exits right away when another signal is received while
+// running jobs are drained after the first one
+func exitOnSecondSignal(ctx context.Context, stop context.CancelFunc) {
+	<-ctx.Done()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	stop()
+	sig := <-signals
+	log.Printf("Received %s while draining, exiting without waiting for running jobs", sig)
+	os.Exit(1)
+}